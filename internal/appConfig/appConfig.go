@@ -1,9 +1,40 @@
 package appConfig
 
-import "gcm/internal/gitlab"
+import (
+	"gcm/internal/ext"
+	"gcm/internal/gitlab"
+)
 
 const DefaultChannelBufferLength = 10
 
+// DefaultMaxConcurrentClones Clones running at the same time across all hosts, unless configured
+const DefaultMaxConcurrentClones = 16
+
 type AppConfig struct {
-	GitLab []gitlab.GitLabConfig `yaml:"gitlab"`
+	GitLab              []gitlab.GitLabConfig `yaml:"gitlab"`
+	MaxConcurrentClones int                   `yaml:"maxConcurrentClones"` // Across all hosts, 0 for the default
+}
+
+func (config AppConfig) GetMaxConcurrentClones() int {
+	return ext.DefaultValue(config.MaxConcurrentClones, DefaultMaxConcurrentClones)
+}
+
+// FindHost is the configuration of a host, nil when it is not configured
+func (config *AppConfig) FindHost(hostName string) *gitlab.GitLabConfig {
+	for i := range config.GitLab {
+		if config.GitLab[i].HostName == hostName {
+			return &config.GitLab[i]
+		}
+	}
+	return nil
+}
+
+// Validate finds configuration errors before any command runs
+func (config AppConfig) Validate() error {
+	for _, gitLabConfig := range config.GitLab {
+		if err := gitLabConfig.ValidateLayouts(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
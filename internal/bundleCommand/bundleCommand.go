@@ -0,0 +1,172 @@
+package bundleCommand
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"gcm/internal/appConfig"
+	"gcm/internal/channel"
+	"gcm/internal/counter"
+	"gcm/internal/gitlab"
+	"gcm/internal/gitrepo"
+	logger "gcm/internal/log"
+	"gcm/internal/view"
+	"github.com/samber/lo"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+)
+
+type BundleCommandViewModel struct {
+	CheckedCount   *counter.Counter
+	BundledCount   *counter.Counter
+	RestoredCount  *counter.Counter
+	SkippedCount   *counter.Counter
+	ErrorViewModel *view.ErrorViewModel
+}
+
+func NewBundleCommandViewModel() *BundleCommandViewModel {
+	return &BundleCommandViewModel{
+		CheckedCount:   counter.NewCounter(),
+		BundledCount:   counter.NewCounter(),
+		RestoredCount:  counter.NewCounter(),
+		SkippedCount:   counter.NewCounter(),
+		ErrorViewModel: view.NewErrorViewModel(logger.GetLogFilePath()),
+	}
+}
+
+func NewBundleCreateCommandView(vm *BundleCommandViewModel) view.View {
+	return newBundleCommandView(vm, "%s working copies checked, %s bundled", vm.CheckedCount, vm.BundledCount)
+}
+
+func NewBundleRestoreCommandView(vm *BundleCommandViewModel) view.View {
+	return newBundleCommandView(
+		vm, "%s bundles checked, %s working copies restored, %s archived skipped",
+		vm.CheckedCount, vm.RestoredCount, vm.SkippedCount,
+	)
+}
+
+func newBundleCommandView(vm *BundleCommandViewModel, format string, counters ...*counter.Counter) view.View {
+	out := os.Stdout
+	compositeView := view.NewCompositeView([]view.View{view.NewCounterView(out, format, counters...)})
+	compositeView.AddFooter(view.NewErrorView(vm.ErrorViewModel, out))
+	compositeView.AddFooter(view.NewTimeElapsedView(time.Now(), out, time.Since))
+	return compositeView
+}
+
+// ExecuteBundleCreateCommand writes a bundle of every working copy of repositories and a manifest listing them
+// into directory. When ctx is done no more bundles are written, the manifest lists those written so far.
+func ExecuteBundleCreateCommand(
+	ctx context.Context,
+	directory string,
+	repositories <-chan gitrepo.GitRepo,
+	errorChannel chan error,
+	vm *BundleCommandViewModel,
+) {
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		errorChannel <- fmt.Errorf("failed to create bundle directory %s: %v", directory, err)
+		return
+	}
+	manifest := Manifest{Created: time.Now().UTC().Format(time.RFC3339), Repositories: []ManifestEntry{}}
+	// Bundling compresses objects, CPU bound
+	workers := runtime.NumCPU()
+	entries := channel.Parallel(repositories, workers, func(repo gitrepo.GitRepo) (ManifestEntry, bool) {
+		if ctx.Err() != nil {
+			return ManifestEntry{}, false
+		}
+		entry := ManifestEntry{
+			HostName:          repo.GetHostName(),
+			ProjectID:         repo.GetProjectID(),
+			Name:              repo.GetName(),
+			PathWithNamespace: repo.GetPathWithNamespace(),
+			SSHURLToRepo:      repo.GetSSHURLToRepo(),
+			Archived:          repo.IsArchived(),
+			Bundle:            bundleFileName(repo.GetHostName(), repo.GetPathWithNamespace()),
+		}
+		bundled, err := repo.CreateBundle(filepath.Join(directory, entry.Bundle))
+		vm.CheckedCount.Add(1)
+		if err != nil {
+			errorChannel <- fmt.Errorf("failed to bundle %s: %v", repo.GetName(), err)
+			return entry, false
+		}
+		if !bundled {
+			logger.Log.Infof("Not bundling %s, it has no commits", repo.GetName())
+			return entry, false
+		}
+		vm.BundledCount.Add(1)
+		return entry, true
+	}, workers)
+	manifest.Repositories = append(manifest.Repositories, lo.ChannelToSlice(entries)...)
+
+	// Sorted, so manifests of the same workspace can be compared
+	slices.SortFunc(manifest.Repositories, func(a, b ManifestEntry) int {
+		return cmp.Or(cmp.Compare(a.HostName, b.HostName), cmp.Compare(a.PathWithNamespace, b.PathWithNamespace))
+	})
+	if err := WriteManifest(directory, manifest); err != nil {
+		errorChannel <- fmt.Errorf("failed to write bundle manifest: %v", err)
+	}
+}
+
+// ExecuteBundleRestoreCommand clones every repository in the manifest of directory from its bundle into the working
+// copy path the configuration gives it and sets it up like a new clone. GitLab is not asked, so it works offline.
+// Existing working copies are kept, archived projects are skipped unless the configuration clones them. When ctx is
+// done no more working copies are restored.
+func ExecuteBundleRestoreCommand(
+	ctx context.Context,
+	directory string,
+	config *appConfig.AppConfig,
+	backend gitrepo.Backend,
+	errorChannel chan error,
+	vm *BundleCommandViewModel,
+) {
+	manifest, err := ReadManifest(directory)
+	if err != nil {
+		errorChannel <- fmt.Errorf("failed to read bundle manifest: %v", err)
+		return
+	}
+	for _, entry := range manifest.Repositories {
+		if ctx.Err() != nil {
+			return
+		}
+		vm.CheckedCount.Add(1)
+		gitLabConfig := config.FindHost(entry.HostName)
+		if gitLabConfig == nil {
+			errorChannel <- fmt.Errorf("not restoring %s, host %s is not configured", entry.Name, entry.HostName)
+			continue
+		}
+		repo := gitLabConfig.ConfiguredRepository(gitlab.Project{
+			ID:                entry.ProjectID,
+			Name:              entry.Name,
+			SSHURLToRepo:      entry.SSHURLToRepo,
+			PathWithNamespace: entry.PathWithNamespace,
+			Archived:          entry.Archived,
+		}, backend)
+		if err := repo.CheckWorkingCopyPath(); err != nil {
+			errorChannel <- fmt.Errorf("cannot place working copy of %s: %v", entry.Name, err)
+			continue
+		}
+		cloned, err := repo.IsCloned()
+		if err != nil {
+			errorChannel <- fmt.Errorf("error checking clone status %s: %v", entry.Name, err)
+			continue
+		}
+		if cloned {
+			logger.Log.Infof("Not restoring %s, %s is already cloned", entry.Name, repo.WorkingCopyPath())
+			continue
+		}
+		restored, err := repo.RestoreFromBundle(filepath.Join(directory, entry.Bundle))
+		if restored {
+			vm.RestoredCount.Add(1)
+		}
+		if err != nil {
+			errorChannel <- fmt.Errorf("failed to restore %s: %v", entry.Name, err)
+			continue
+		}
+		if !restored {
+			logger.Log.Infof("Not restoring %s, it is archived and cloneArchived is off", entry.Name)
+			vm.SkippedCount.Add(1)
+		}
+	}
+}
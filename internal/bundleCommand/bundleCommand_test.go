@@ -0,0 +1,100 @@
+package bundleCommand
+
+import (
+	"context"
+	"gcm/internal/appConfig"
+	"gcm/internal/gitlab"
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
+	repotesting "gcm/internal/gitrepo/testing"
+	"path"
+	"testing"
+)
+
+func TestBundleCreateAndRestore(t *testing.T) {
+	workspace := repotesting.NewWorkspace(t)
+	config := &appConfig.AppConfig{
+		GitLab: []gitlab.GitLabConfig{
+			{
+				HostName:       repotesting.HostName,
+				CloneDirectory: workspace.CloneDirectory,
+				Groups:         []gitlab.GroupConfig{{Name: "platform", Layout: "{{.Project}}", CloneArchived: true}},
+				Projects: []gitremote.GitRemoteProjectConfig{
+					{
+						Name:     "app",
+						FullPath: "team/app",
+						CloneConfig: gitremote.CloneConfig{
+							PostClone: gitremote.PostCloneConfig{GitConfig: map[string]string{"user.email": "dev@example.com"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	gitLabConfig := &config.GitLab[0]
+	backend := workspace.Backend
+	projects := []gitlab.Project{
+		{Name: "app", PathWithNamespace: "team/app"},
+		{ID: 42, Name: "svc", PathWithNamespace: "platform/backend/svc", SSHURLToRepo: "git@gitlab.example.com:platform/backend/svc"},
+		{ID: 43, Name: "empty", PathWithNamespace: "platform/empty", SSHURLToRepo: "git@gitlab.example.com:platform/empty"},
+		{
+			ID:                44,
+			Name:              "old",
+			PathWithNamespace: "platform/old",
+			SSHURLToRepo:      "git@gitlab.example.com:platform/old",
+			Archived:          true,
+		},
+	}
+	var repos []*gitrepo.GitRepository
+	for _, project := range projects {
+		repo := gitLabConfig.ConfiguredRepository(project, backend)
+		if project.Name == "empty" {
+			workspace.CloneFrom(t, gitrepo.FakeRemote{Branches: []string{"main"}}, repo)
+		} else {
+			workspace.CloneFrom(t, gitrepo.FakeRemote{Branches: []string{"main"}, Commits: 3}, repo)
+		}
+		repos = append(repos, repo)
+	}
+
+	bundleDirectory := t.TempDir()
+	vm := NewBundleCommandViewModel()
+	errorChannel := make(chan error, 10)
+	ExecuteBundleCreateCommand(context.Background(), bundleDirectory, repotesting.Channel(repos...), errorChannel, vm)
+	if count := vm.BundledCount.Count(); count != 3 {
+		t.Errorf("expected 3 bundles, got %d", count)
+	}
+	manifest, err := ReadManifest(bundleDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Repositories) != 3 || manifest.Repositories[0].ProjectID != 42 ||
+		manifest.Repositories[2].Bundle != "gitlab.example.com/team/app.bundle" {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+
+	// Restore into an empty workspace, now leaving out archived projects
+	gitLabConfig.CloneDirectory = t.TempDir()
+	gitLabConfig.Groups[0].CloneArchived = false
+	vm = NewBundleCommandViewModel()
+	ExecuteBundleRestoreCommand(context.Background(), bundleDirectory, config, backend, errorChannel, vm)
+	close(errorChannel)
+	for err := range errorChannel {
+		t.Errorf("unexpected error %v", err)
+	}
+	if restored, skipped := vm.RestoredCount.Count(), vm.SkippedCount.Count(); restored != 2 || skipped != 1 {
+		t.Errorf("expected 2 restored working copies and 1 skipped, got %d restored and %d skipped", restored, skipped)
+	}
+	appPath := path.Join(gitLabConfig.CloneDirectory, "team/app")
+	if email, err := backend.ConfigValue(appPath, "user.email"); err != nil || email != "dev@example.com" {
+		t.Errorf("expected post-clone git config to be set, got %q, %v", email, err)
+	}
+	for workingCopy, url := range map[string]string{
+		"team/app": "git@gitlab.example.com:team/app",
+		"svc":      "git@gitlab.example.com:platform/backend/svc",
+	} {
+		origin, err := backend.RemoteURL(path.Join(gitLabConfig.CloneDirectory, workingCopy), gitrepo.OriginRemote)
+		if err != nil || origin != url {
+			t.Errorf("expected %s restored with origin %s, got %q, %v", workingCopy, url, origin, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package bundleCommand
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const ManifestFileName = "manifest.json"
+
+// Manifest Lists the repositories in a bundle directory, so a workspace can be restored without asking GitLab
+type Manifest struct {
+	Created      string          `json:"created"`
+	Repositories []ManifestEntry `json:"repositories"`
+}
+
+type ManifestEntry struct {
+	HostName          string `json:"hostName"`
+	ProjectID         int    `json:"projectId,omitempty"` // Not known for projects configured directly
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"pathWithNamespace"`
+	SSHURLToRepo      string `json:"sshUrlToRepo"`
+	Archived          bool   `json:"archived"`
+	Bundle            string `json:"bundle"` // Bundle file relative to the manifest
+}
+
+// bundleFileName places the bundle of a project below the bundle directory, e.g. gitlab.com/group/project.bundle
+func bundleFileName(hostName string, pathWithNamespace string) string {
+	return filepath.ToSlash(filepath.Join(hostName, pathWithNamespace)) + ".bundle"
+}
+
+func WriteManifest(directory string, manifest Manifest) error {
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(directory, ManifestFileName), append(out, '\n'), 0644)
+}
+
+func ReadManifest(directory string) (Manifest, error) {
+	var manifest Manifest
+	in, err := os.ReadFile(filepath.Join(directory, ManifestFileName))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(in, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid manifest %s: %v", filepath.Join(directory, ManifestFileName), err)
+	}
+	for _, entry := range manifest.Repositories {
+		if !filepath.IsLocal(entry.Bundle) || !strings.HasSuffix(entry.Bundle, ".bundle") {
+			return manifest, fmt.Errorf("invalid bundle %q for %s in manifest", entry.Bundle, entry.PathWithNamespace)
+		}
+	}
+	return manifest, nil
+}
@@ -0,0 +1,16 @@
+package channel
+
+import "gcm/internal/counter"
+
+// Counted passes all items on, counting each one on the way
+func Counted[T any](input <-chan T, itemCounter *counter.Counter, bufferSize int) <-chan T {
+	output := make(chan T, bufferSize)
+	go func() {
+		for item := range input {
+			itemCounter.Add(1)
+			output <- item
+		}
+		close(output)
+	}()
+	return output
+}
@@ -0,0 +1,85 @@
+package channel
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket. Tokens are added at a rate per second up to the burst size and every Wait takes one, so
+// after a quiet period up to burst callers pass at once and the rest follow at the rate. A rate of 0 or less does not
+// limit at all. The rate can be changed while callers are waiting.
+type Limiter struct {
+	mutex       sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	updated     time.Time
+	rateChanged chan struct{} // Closed and replaced by SetRate to wake up waiting callers
+}
+
+// NewLimiter creates a limiter with a full bucket, burst is at least 1
+func NewLimiter(ratePerSecond float64, burst int) *Limiter {
+	return &Limiter{
+		rate:        ratePerSecond,
+		burst:       float64(max(burst, 1)),
+		tokens:      float64(max(burst, 1)),
+		updated:     time.Now(),
+		rateChanged: make(chan struct{}),
+	}
+}
+
+// Wait takes a token, waiting for one if the bucket is empty. It returns ctx.Err() when ctx is done first.
+func (limiter *Limiter) Wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		limiter.mutex.Lock()
+		limiter.refill(time.Now())
+		if limiter.rate <= 0 {
+			limiter.mutex.Unlock()
+			return nil
+		}
+		if limiter.tokens >= 1 {
+			limiter.tokens--
+			limiter.mutex.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - limiter.tokens) / limiter.rate * float64(time.Second))
+		rateChanged := limiter.rateChanged
+		limiter.mutex.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+		case <-rateChanged:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// SetRate changes the rate, tokens added so far are kept
+func (limiter *Limiter) SetRate(ratePerSecond float64) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.refill(time.Now())
+	limiter.rate = ratePerSecond
+	close(limiter.rateChanged)
+	limiter.rateChanged = make(chan struct{})
+}
+
+// Rate is the current rate per second, 0 or less when not limited
+func (limiter *Limiter) Rate() float64 {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	return limiter.rate
+}
+
+func (limiter *Limiter) refill(now time.Time) {
+	if limiter.rate > 0 {
+		limiter.tokens = min(limiter.burst, limiter.tokens+now.Sub(limiter.updated).Seconds()*limiter.rate)
+	}
+	limiter.updated = now
+}
@@ -0,0 +1,76 @@
+package channel
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func waitTimes(t *testing.T, limiter *Limiter, times int) time.Duration {
+	start := time.Now()
+	for range times {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return time.Since(start)
+}
+
+func TestLimiter_PassesBurstAtOnce(t *testing.T) {
+	limiter := NewLimiter(1, 5)
+
+	if elapsed := waitTimes(t, limiter, 5); elapsed > 50*time.Millisecond {
+		t.Errorf("expected a burst of 5 to pass at once, took %v", elapsed)
+	}
+}
+
+func TestLimiter_FollowsRateAfterBurst(t *testing.T) {
+	limiter := NewLimiter(100, 2)
+
+	// Two pass at once, the other three 10ms apart
+	if elapsed := waitTimes(t, limiter, 5); elapsed < 30*time.Millisecond {
+		t.Errorf("expected at least 30ms, took %v", elapsed)
+	}
+}
+
+func TestLimiter_DoesNotLimitWithoutRate(t *testing.T) {
+	limiter := NewLimiter(0, 1)
+
+	if elapsed := waitTimes(t, limiter, 1000); elapsed > 50*time.Millisecond {
+		t.Errorf("expected no limit with rate 0, took %v", elapsed)
+	}
+}
+
+func TestLimiter_SetRateWakesWaitingCallers(t *testing.T) {
+	limiter := NewLimiter(0.01, 1)
+	waitTimes(t, limiter, 1)
+	done := make(chan error)
+	go func() {
+		done <- limiter.Wait(context.Background())
+	}()
+
+	limiter.SetRate(0)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the waiting caller to pass after the limit was removed")
+	}
+	if rate := limiter.Rate(); rate != 0 {
+		t.Errorf("expected rate 0, got %v", rate)
+	}
+}
+
+func TestLimiter_StopsWaitingWhenCancelled(t *testing.T) {
+	limiter := NewLimiter(0.01, 1)
+	waitTimes(t, limiter, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.Wait(ctx); err == nil {
+		t.Error("expected an error when the context is done while waiting")
+	}
+}
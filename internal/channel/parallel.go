@@ -0,0 +1,26 @@
+package channel
+
+import "sync"
+
+// Parallel calls work for every item of input with at most workers calls running at the same time and passes on the
+// results work keeps, in no particular order. The output is closed once input is closed and all calls are done.
+func Parallel[T any, R any](input <-chan T, workers int, work func(T) (R, bool), bufferSize int) <-chan R {
+	output := make(chan R, bufferSize)
+	var waitGroup sync.WaitGroup
+	for range max(workers, 1) {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for item := range input {
+				if result, keep := work(item); keep {
+					output <- result
+				}
+			}
+		}()
+	}
+	go func() {
+		waitGroup.Wait()
+		close(output)
+	}()
+	return output
+}
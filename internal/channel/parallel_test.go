@@ -0,0 +1,41 @@
+package channel
+
+import (
+	"github.com/samber/lo"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallel_KeepsResultsWithBoundedWorkers(t *testing.T) {
+	input := make(chan int, 20)
+	for i := range 20 {
+		input <- i
+	}
+	close(input)
+	var running, maxRunning atomic.Int32
+
+	output := Parallel(input, 3, func(i int) (int, bool) {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			seen := maxRunning.Load()
+			if current <= seen || maxRunning.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return i * 10, i%2 == 0
+	}, 0)
+	results := lo.ChannelToSlice(output)
+
+	slices.Sort(results)
+	expected := []int{0, 20, 40, 60, 80, 100, 120, 140, 160, 180}
+	if !slices.Equal(results, expected) {
+		t.Errorf("expected results %v, got %v", expected, results)
+	}
+	if maxRunning.Load() > 3 {
+		t.Errorf("expected at most 3 calls at the same time, got %d", maxRunning.Load())
+	}
+}
@@ -1,19 +1,20 @@
 package channel
 
 import (
-	"time"
+	"context"
 )
 
-func RateLimit[T any](input <-chan T, ratePerSecond int, bufferSize int) <-chan T {
+// RateLimit passes items on as limiter allows until input is closed. Once ctx is done the remaining items are passed
+// on without waiting, so the receiver sees every item and can account for those it no longer processes.
+func RateLimit[T any](ctx context.Context, input <-chan T, limiter *Limiter, bufferSize int) <-chan T {
 	output := make(chan T, bufferSize)
 	go func() {
-		ticker := time.NewTicker(time.Second / time.Duration(ratePerSecond))
-		defer ticker.Stop()
+		defer close(output)
 		for item := range input {
-			<-ticker.C
+			// Wait only fails once ctx is done
+			_ = limiter.Wait(ctx)
 			output <- item
 		}
-		close(output)
 	}()
 	return output
 }
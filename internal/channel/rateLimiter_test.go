@@ -0,0 +1,28 @@
+package channel
+
+import (
+	"context"
+	"github.com/samber/lo"
+	"testing"
+	"time"
+)
+
+func TestRateLimit_PassesRemainingItemsOnceCancelled(t *testing.T) {
+	input := make(chan int, 10)
+	for i := range 10 {
+		input <- i
+	}
+	close(input)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	output := lo.ChannelToSlice(RateLimit(ctx, input, NewLimiter(1, 1), 0))
+
+	if len(output) != 10 {
+		t.Errorf("expected all 10 items to be passed on, got %v", output)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected items to be passed on without waiting once cancelled, took %v", elapsed)
+	}
+}
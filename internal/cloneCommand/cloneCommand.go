@@ -1,38 +1,45 @@
 package cloneCommand
 
 import (
+	"context"
 	"fmt"
 	"gcm/internal/appConfig"
 	"gcm/internal/channel"
 	"gcm/internal/cloneCommand/terminalView"
+	"gcm/internal/color"
+	"gcm/internal/ext"
 	"gcm/internal/gitlab"
 	"gcm/internal/gitrepo"
 	logger "gcm/internal/log"
 	"github.com/samber/lo"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sync"
 )
 
 type CloneCommandView struct {
 }
 
+// ExecuteCloneCommand clones every configured repository that has no working copy yet. When ctx is done no more
+// clones start, and ExecuteCloneCommand returns once the running ones have finished or were killed.
 func ExecuteCloneCommand(
+	ctx context.Context,
 	config *appConfig.AppConfig,
+	backend gitrepo.Backend,
 	errorChannel chan error,
 	vm *terminalView.CloneCommandViewModel,
 ) {
 
-	var cloneChannelsRateLimited []<-chan gitrepo.GitRepo
+	pool := gitrepo.NewClonePool(config.GetMaxConcurrentClones())
+	cloneWaitGroup := sync.WaitGroup{}
 	for _, gitLabConfig := range config.GitLab {
 		absPath, _ := filepath.Abs(gitLabConfig.CloneDirectory)
 		cloneViewModel := vm.AddGitLabCloneVM(gitLabConfig.HostName, absPath)
 		token := gitLabConfig.RetrieveTokenFromEnv()
 		if token == "" {
-			errorChannel <- fmt.Errorf(
-				"Gitlab token env variable %s not set for %s; skipping",
-				gitLabConfig.EnvTokenVariableName,
-				gitLabConfig.HostName,
-			)
+			errorChannel <- gitLabConfig.MissingTokenError()
 			continue
 		}
 
@@ -41,30 +48,241 @@ func ExecuteCloneCommand(
 			logger.Log.Fatalf("Failed to create clone root directory: %v", err)
 		}
 
-		labApi := gitlab.NewAPIClient(token, gitLabConfig.HostName)
-		channeledApi := gitlab.NewChanneledApi(
-			labApi, &gitLabConfig, cloneViewModel.GroupProjectCount, cloneViewModel.GroupCount, errorChannel,
+		repositories := discoverRepositories(
+			ctx, gitLabConfig, token, backend, cloneViewModel, vm.ClonedNowViewModel.RunReport, errorChannel,
 		)
-		remoteRepoChannel := channeledApi.ScheduleDirectProjects(cloneViewModel.DirectProjectCount)
-
-		gitlabGroupProjectsChannel := channeledApi.ScheduleGitlabGroupProjectsFetch(gitLabConfig.Groups)
-		reposChannel := gitlab.ConvertProjectsToRepos(gitlabGroupProjectsChannel)
-
-		var potentialClonesChannel []<-chan gitrepo.GitRepo
-		potentialClonesChannel = append(potentialClonesChannel, reposChannel, remoteRepoChannel)
-		in := lo.FanIn(appConfig.DefaultChannelBufferLength, potentialClonesChannel...)
-		var cloneChannelRateLimited = channel.RateLimit[gitrepo.GitRepo](
-			gitrepo.FilterCloneNeeded(
-				in, cloneViewModel.ArchivedCloneCounter, cloneViewModel.CloneCount, errorChannel,
-			), gitLabConfig.GetConfiguredCloneRate(), appConfig.DefaultChannelBufferLength,
+		in := gitrepo.SyncArchivedMarkers(
+			gitrepo.SyncWorktrees(
+				gitrepo.ApplySparseCheckouts(
+					repositories,
+					vm.ClonedNowViewModel.SparseCheckoutUpdateCount,
+					errorChannel,
+				),
+				vm.ClonedNowViewModel.WorktreeAddedCount,
+				vm.ClonedNowViewModel.WorktreeRemovedCount,
+				errorChannel,
+			),
+			func(repo gitrepo.GitRepo) {
+				vm.ArchivedStateViewModel.AddChange(repo.WorkingCopyPath(), repo.IsArchived())
+			},
+			vm.ClonedNowViewModel.RunReport,
+			errorChannel,
 		)
-
-		cloneChannelsRateLimited = append(cloneChannelsRateLimited, cloneChannelRateLimited)
+		needsCloning := gitrepo.FilterCloneNeeded(
+			in,
+			cloneViewModel.ArchivedCloneCounter,
+			cloneViewModel.CloneCount,
+			vm.ClonedNowViewModel.RunReport,
+			errorChannel,
+		)
+		cloneLimiter, adaptiveRate := newHostCloneRate(gitLabConfig, cloneViewModel)
+		cloneWaitGroup.Add(1)
+		go func() {
+			defer cloneWaitGroup.Done()
+			cloneHostRepositories(
+				ctx, gitLabConfig, needsCloning, cloneLimiter, adaptiveRate, pool, vm, errorChannel,
+			)
+		}()
 	}
+	cloneWaitGroup.Wait()
+}
+
+// newHostCloneRate creates the limiter starting clones of a host, with its adaptive rate shown by cloneViewModel.
+// Built before cloning runs in the background, the view never sees a rate being replaced.
+func newHostCloneRate(
+	gitLabConfig gitlab.GitLabConfig,
+	cloneViewModel *terminalView.GitLabCloneViewModel,
+) (*channel.Limiter, *gitrepo.AdaptiveCloneRate) {
+	cloneLimiter := gitLabConfig.NewCloneLimiter()
+	adaptiveRate := gitLabConfig.NewAdaptiveCloneRate(cloneLimiter)
+	cloneViewModel.SetAdaptiveCloneRate(adaptiveRate)
+	return cloneLimiter, adaptiveRate
+}
+
+// cloneHostRepositories clones repositories of one host as they come in, starting clones at the rate of cloneLimiter
+// and running them in slots of pool
+func cloneHostRepositories(
+	ctx context.Context,
+	gitLabConfig gitlab.GitLabConfig,
+	repositories <-chan gitrepo.GitRepo,
+	cloneLimiter *channel.Limiter,
+	adaptiveRate *gitrepo.AdaptiveCloneRate,
+	pool *gitrepo.ClonePool,
+	vm *terminalView.CloneCommandViewModel,
+	errorChannel chan error,
+) {
+	queued := channel.Counted(repositories, vm.ClonedNowViewModel.QueuedCount, appConfig.DefaultChannelBufferLength)
+	rateLimited := channel.RateLimit(ctx, queued, cloneLimiter, appConfig.DefaultChannelBufferLength)
 
+	// The rate limit controls how fast clones start, the pool how many run at the same time
 	gitrepo.CloneRepositories(
-		lo.FanIn(appConfig.DefaultChannelBufferLength, cloneChannelsRateLimited...),
-		vm.ClonedNowViewModel.ClonedNowCount,
+		ctx,
+		rateLimited,
+		pool,
+		gitLabConfig.MaxConcurrentClones,
+		vm.ClonedNowViewModel.CloneCounters(),
+		cloneLimiter,
+		adaptiveRate,
+		gitLabConfig.GetConfiguredCloneRetries(),
 		errorChannel,
 	)
 }
+
+// ExecuteApplyCommand clones the repositories a plan clones, with the rate limits and retries configured for their
+// host, or the defaults when the host is not configured. Entries cloned since the plan was made are left alone.
+func ExecuteApplyCommand(
+	ctx context.Context,
+	plan Plan,
+	config *appConfig.AppConfig,
+	backend gitrepo.Backend,
+	errorChannel chan error,
+	vm *terminalView.CloneCommandViewModel,
+) {
+	byHost := make(map[string][]gitrepo.GitRepo)
+	cloneDirectories := make(map[string]string)
+	var hostNames []string
+	for _, entry := range plan.Repositories {
+		if entry.Action != ActionClone {
+			continue
+		}
+		repo, err := entry.Repository(backend)
+		if err == nil {
+			err = entry.CheckConfiguredSetup(config)
+		}
+		if err != nil {
+			vm.ClonedNowViewModel.RunReport.RecordFailed(gitrepo.RunReportEntry{
+				HostName:          entry.HostName,
+				Group:             path.Dir(entry.PathWithNamespace),
+				Name:              entry.Name,
+				PathWithNamespace: entry.PathWithNamespace,
+				Path:              entry.Path,
+			}, fmt.Errorf("cannot apply the plan: %v", err))
+			errorChannel <- fmt.Errorf("cannot apply the plan for %s: %v", entry.Name, err)
+			continue
+		}
+		if _, known := byHost[entry.HostName]; !known {
+			hostNames = append(hostNames, entry.HostName)
+			cloneDirectories[entry.HostName], _ = filepath.Abs(entry.CloneDirectory)
+		}
+		byHost[entry.HostName] = append(byHost[entry.HostName], repo)
+	}
+
+	pool := gitrepo.NewClonePool(config.GetMaxConcurrentClones())
+	cloneWaitGroup := sync.WaitGroup{}
+	for _, hostName := range hostNames {
+		gitLabConfig := gitlab.GitLabConfig{HostName: hostName}
+		if configured := config.FindHost(hostName); configured != nil {
+			gitLabConfig = *configured
+		}
+		cloneViewModel := vm.AddGitLabCloneVM(hostName, cloneDirectories[hostName])
+		repositories := make(chan gitrepo.GitRepo, len(byHost[hostName]))
+		for _, repo := range byHost[hostName] {
+			repositories <- repo
+		}
+		close(repositories)
+		needsCloning := gitrepo.FilterCloneNeeded(
+			repositories,
+			cloneViewModel.ArchivedCloneCounter,
+			cloneViewModel.CloneCount,
+			vm.ClonedNowViewModel.RunReport,
+			errorChannel,
+		)
+		cloneLimiter, adaptiveRate := newHostCloneRate(gitLabConfig, cloneViewModel)
+		cloneWaitGroup.Add(1)
+		go func() {
+			defer cloneWaitGroup.Done()
+			cloneHostRepositories(
+				ctx, gitLabConfig, needsCloning, cloneLimiter, adaptiveRate, pool, vm, errorChannel,
+			)
+		}()
+	}
+	cloneWaitGroup.Wait()
+}
+
+// discoverRepositories channels the repositories of a host the way cloning sees them, leaving out colliding paths.
+// What is left out is recorded as failed to report, which may be nil.
+func discoverRepositories(
+	ctx context.Context,
+	gitLabConfig gitlab.GitLabConfig,
+	token string,
+	backend gitrepo.Backend,
+	cloneViewModel *terminalView.GitLabCloneViewModel,
+	report *gitrepo.RunReport,
+	errorChannel chan error,
+) <-chan gitrepo.GitRepo {
+	labApi := gitlab.NewAPIClient(token, gitLabConfig)
+	channeledApi := gitlab.NewChanneledApi(
+		ctx, labApi, &gitLabConfig, cloneViewModel.GroupProjectCount, cloneViewModel.GroupCount, report, errorChannel,
+	)
+	repositories := channeledApi.ScheduleRepositories(cloneViewModel.DirectProjectCount, backend)
+	if gitLabConfig.HasCustomLayout() {
+		repositories = gitrepo.DetectPathCollisions(repositories, report, errorChannel)
+	}
+	return repositories
+}
+
+// ExecuteClonePlanCommand finds the configured repositories like ExecuteCloneCommand and decides which need cloning,
+// but changes nothing on disk. The plan of all hosts is ordered by working copy path.
+func ExecuteClonePlanCommand(
+	ctx context.Context,
+	config *appConfig.AppConfig,
+	backend gitrepo.Backend,
+	errorChannel chan error,
+	vm *terminalView.CloneCommandViewModel,
+) []gitrepo.ClonePlanEntry {
+	var plan []gitrepo.ClonePlanEntry
+	var planMutex sync.Mutex
+	planWaitGroup := sync.WaitGroup{}
+	for _, gitLabConfig := range config.GitLab {
+		absPath, _ := filepath.Abs(gitLabConfig.CloneDirectory)
+		cloneViewModel := vm.AddGitLabCloneVM(gitLabConfig.HostName, absPath)
+		token := gitLabConfig.RetrieveTokenFromEnv()
+		if token == "" {
+			errorChannel <- gitLabConfig.MissingTokenError()
+			continue
+		}
+		repositories := discoverRepositories(ctx, gitLabConfig, token, backend, cloneViewModel, nil, errorChannel)
+		planWaitGroup.Add(1)
+		go func() {
+			defer planWaitGroup.Done()
+			hostPlan := gitrepo.PlanClones(
+				repositories, cloneViewModel.ArchivedCloneCounter, cloneViewModel.CloneCount, errorChannel,
+			)
+			planMutex.Lock()
+			defer planMutex.Unlock()
+			plan = append(plan, hostPlan...)
+		}()
+	}
+	planWaitGroup.Wait()
+	gitrepo.SortClonePlan(plan)
+	return plan
+}
+
+// PrintClonePlan lists the repositories a plan would clone, where and the post-clone commands run in them, followed
+// by those skipped and why
+func PrintClonePlan(out io.Writer, plan []gitrepo.ClonePlanEntry) {
+	clones := lo.Filter(plan, func(entry gitrepo.ClonePlanEntry, _ int) bool { return entry.WouldClone() })
+	_, _ = fmt.Fprintf(out, "Would clone %s repositories:\n", color.FgMagenta(fmt.Sprintf("%d", len(clones))))
+	for _, entry := range clones {
+		_, _ = fmt.Fprintf(
+			out, "  %s <- %s\n",
+			color.FgCyan(ext.ReplaceHomeDirWithTilde(entry.Repo.WorkingCopyPath())),
+			entry.Repo.GetSSHURLToRepo(),
+		)
+		for _, command := range entry.Repo.GetCloneOptions().CloneConfig().PostClone.Commands {
+			_, _ = fmt.Fprintf(out, "      then runs %s\n", command)
+		}
+	}
+	skipped := len(plan) - len(clones)
+	if skipped == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(out, "Skipping %s repositories:\n", color.FgMagenta(fmt.Sprintf("%d", skipped)))
+	for _, entry := range plan {
+		if !entry.WouldClone() {
+			_, _ = fmt.Fprintf(
+				out, "  %s: %s\n", ext.ReplaceHomeDirWithTilde(entry.Repo.WorkingCopyPath()), entry.SkipReason,
+			)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package cloneCommand
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gcm/internal/appConfig"
+	"gcm/internal/cloneCommand/terminalView"
+	"gcm/internal/gitlab"
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExecuteCloneCommand_DirectProjects(t *testing.T) {
+	t.Setenv("GCM_TEST_TOKEN", "secret")
+	cloneDirectory := t.TempDir()
+	config := &appConfig.AppConfig{
+		GitLab: []gitlab.GitLabConfig{
+			{
+				EnvTokenVariableName: "GCM_TEST_TOKEN",
+				HostName:             "gitlab.example.com",
+				CloneDirectory:       cloneDirectory,
+				Projects: []gitremote.GitRemoteProjectConfig{
+					{Name: "app", FullPath: "team/app"},
+					{Name: "lib", FullPath: "team/lib"},
+					{Name: "broken", FullPath: "team/broken"},
+				},
+				CloneRetries: -1,
+			},
+		},
+	}
+	backend := gitrepo.NewFakeBackend()
+	backend.AddRemote("git@gitlab.example.com:team/app", gitrepo.FakeRemote{Branches: []string{"main"}})
+	backend.AddRemote("git@gitlab.example.com:team/lib", gitrepo.FakeRemote{Branches: []string{"main"}})
+	backend.AddRemote(
+		"git@gitlab.example.com:team/broken",
+		gitrepo.FakeRemote{CloneError: fmt.Errorf("Connection reset by peer")},
+	)
+	vm := terminalView.NewCloneCommandViewModel()
+	errorChannel := make(chan error, 10)
+
+	ExecuteCloneCommand(context.Background(), config, backend, errorChannel, vm)
+	close(errorChannel)
+
+	if count := vm.ClonedNowViewModel.ClonedNowCount.Count(); count != 2 {
+		t.Errorf("expected 2 clones, got %d", count)
+	}
+	for _, fullPath := range []string{"team/app", "team/lib"} {
+		if _, err := backend.Status(path.Join(cloneDirectory, fullPath)); err != nil {
+			t.Errorf("expected %s to be cloned: %v", fullPath, err)
+		}
+	}
+	var errors []error
+	for err := range errorChannel {
+		errors = append(errors, err)
+	}
+	if len(errors) != 1 {
+		t.Errorf("expected 1 clone error, got %v", errors)
+	}
+
+	// A second run finds the clones already there, and retries the broken one
+	vm = terminalView.NewCloneCommandViewModel()
+	errorChannel = make(chan error, 10)
+	ExecuteCloneCommand(context.Background(), config, backend, errorChannel, vm)
+	if count := vm.ClonedNowViewModel.ClonedNowCount.Count(); count != 0 {
+		t.Errorf("expected no clones on second run, got %d", count)
+	}
+	if count := vm.GitLabCloneViewModels[0].CloneCount.Count(); count != 3 {
+		t.Errorf("expected 3 git clones counted on second run, got %d", count)
+	}
+}
+
+func TestExecuteCloneCommand_SparseCheckout(t *testing.T) {
+	t.Setenv("GCM_TEST_TOKEN", "secret")
+	cloneDirectory := t.TempDir()
+	project := gitremote.GitRemoteProjectConfig{
+		Name:        "monorepo",
+		FullPath:    "team/monorepo",
+		CloneConfig: gitremote.CloneConfig{SparseCheckout: []string{"services/api"}},
+	}
+	config := &appConfig.AppConfig{
+		GitLab: []gitlab.GitLabConfig{
+			{
+				EnvTokenVariableName: "GCM_TEST_TOKEN",
+				HostName:             "gitlab.example.com",
+				CloneDirectory:       cloneDirectory,
+				Projects:             []gitremote.GitRemoteProjectConfig{project},
+			},
+		},
+	}
+	backend := gitrepo.NewFakeBackend()
+	backend.AddRemote("git@gitlab.example.com:team/monorepo", gitrepo.FakeRemote{Branches: []string{"main"}})
+	workingCopy := path.Join(cloneDirectory, "team/monorepo")
+
+	ExecuteCloneCommand(context.Background(), config, backend, make(chan error, 10), terminalView.NewCloneCommandViewModel())
+	sparse, err := backend.SparseCheckout(workingCopy)
+	if err != nil || !slices.Equal(sparse, []string{"services/api"}) {
+		t.Errorf("expected sparse checkout of services/api after clone, got %v, %v", sparse, err)
+	}
+
+	config.GitLab[0].Projects[0].SparseCheckout = []string{"services/api", "libs"}
+	vm := terminalView.NewCloneCommandViewModel()
+	ExecuteCloneCommand(context.Background(), config, backend, make(chan error, 10), vm)
+	sparse, _ = backend.SparseCheckout(workingCopy)
+	if !slices.Equal(sparse, []string{"services/api", "libs"}) {
+		t.Errorf("expected changed sparse checkout to be re-applied, got %v", sparse)
+	}
+	if count := vm.ClonedNowViewModel.SparseCheckoutUpdateCount.Count(); count != 1 {
+		t.Errorf("expected 1 sparse checkout update, got %d", count)
+	}
+
+	config.GitLab[0].Projects[0].SparseCheckout = nil
+	ExecuteCloneCommand(context.Background(), config, backend, make(chan error, 10), terminalView.NewCloneCommandViewModel())
+	if sparse, _ = backend.SparseCheckout(workingCopy); sparse != nil {
+		t.Errorf("expected sparse checkout to be disabled, got %v", sparse)
+	}
+}
+
+func TestExecuteClonePlanCommand_ClonesNothing(t *testing.T) {
+	t.Setenv("GCM_TEST_TOKEN", "secret")
+	cloneDirectory := t.TempDir()
+	config := &appConfig.AppConfig{
+		GitLab: []gitlab.GitLabConfig{
+			{
+				EnvTokenVariableName: "GCM_TEST_TOKEN",
+				HostName:             "gitlab.example.com",
+				CloneDirectory:       cloneDirectory,
+				Projects:             []gitremote.GitRemoteProjectConfig{{Name: "app", FullPath: "team/app"}},
+			},
+		},
+	}
+	backend := gitrepo.NewFakeBackend()
+	backend.AddRemote("git@gitlab.example.com:team/app", gitrepo.FakeRemote{Branches: []string{"main"}})
+	backend.AddRemote("git@gitlab.example.com:team/lib", gitrepo.FakeRemote{Branches: []string{"main"}})
+	ExecuteCloneCommand(context.Background(), config, backend, make(chan error, 10), terminalView.NewCloneCommandViewModel())
+	config.GitLab[0].Projects = append(config.GitLab[0].Projects, gitremote.GitRemoteProjectConfig{
+		Name:        "lib",
+		FullPath:    "team/lib",
+		CloneConfig: gitremote.CloneConfig{PostClone: gitremote.PostCloneConfig{Commands: []string{"make bootstrap"}}},
+	})
+
+	plan := ExecuteClonePlanCommand(
+		context.Background(), config, backend, make(chan error, 10), terminalView.NewCloneCommandViewModel(),
+	)
+
+	if len(plan) != 2 || plan[0].SkipReason != gitrepo.SkipAlreadyCloned || !plan[1].WouldClone() {
+		t.Fatalf("expected app to be skipped as cloned and lib to be cloned, got %v", plan)
+	}
+	if _, err := backend.Status(path.Join(cloneDirectory, "team/lib")); err == nil {
+		t.Errorf("expected the plan not to clone team/lib")
+	}
+	var out bytes.Buffer
+	PrintClonePlan(&out, plan)
+	for _, expected := range []string{
+		"team/lib <- git@gitlab.example.com:team/lib\n      then runs make bootstrap",
+		"team/app: already cloned",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected the printed plan to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+}
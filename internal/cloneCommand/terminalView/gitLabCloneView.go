@@ -5,9 +5,11 @@ import (
 	"gcm/internal/color"
 	"gcm/internal/counter"
 	"gcm/internal/ext"
+	"gcm/internal/gitrepo"
 	"gcm/internal/view"
 	"io"
 	"strings"
+	"sync"
 )
 
 type GitLabCloneViewModel struct {
@@ -18,6 +20,8 @@ type GitLabCloneViewModel struct {
 	DirectProjectCount   *counter.Counter
 	CloneCount           *counter.Counter
 	ArchivedCloneCounter *counter.Counter
+	mutex                sync.Mutex
+	adaptiveCloneRate    *gitrepo.AdaptiveCloneRate // nil when the clone rate is fixed
 }
 
 func NewGitLabCloneViewModel(remoteHostName string, cloneRoot string) *GitLabCloneViewModel {
@@ -32,6 +36,19 @@ func NewGitLabCloneViewModel(remoteHostName string, cloneRoot string) *GitLabClo
 	}
 }
 
+// SetAdaptiveCloneRate shows the adaptive rate clones of the host start at, nil when the rate is fixed
+func (vm *GitLabCloneViewModel) SetAdaptiveCloneRate(adaptiveCloneRate *gitrepo.AdaptiveCloneRate) {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	vm.adaptiveCloneRate = adaptiveCloneRate
+}
+
+func (vm *GitLabCloneViewModel) getAdaptiveCloneRate() *gitrepo.AdaptiveCloneRate {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	return vm.adaptiveCloneRate
+}
+
 // GitLabCloneView handles rendering counters in different modes
 type GitLabCloneView struct {
 	viewModelsProvider func() []*GitLabCloneViewModel
@@ -60,6 +77,12 @@ func (r *GitLabCloneView) Render(width int) (lines int) {
 				color.FgMagenta(fmt.Sprintf("%d", vm.ArchivedCloneCounter.Count())),
 			),
 		)
+		if adaptiveCloneRate := vm.getAdaptiveCloneRate(); adaptiveCloneRate != nil {
+			out.WriteString(fmt.Sprintf(
+				"    %s clones per second (adaptive)\n",
+				color.FgMagenta(fmt.Sprintf("%.1f", adaptiveCloneRate.Rate())),
+			))
+		}
 	}
 	_, err := fmt.Fprint(r.stdout, out.String())
 	if err != nil {
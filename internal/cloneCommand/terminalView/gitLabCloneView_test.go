@@ -3,7 +3,9 @@ package terminalView
 import (
 	"bytes"
 	"fmt"
+	"gcm/internal/channel"
 	"gcm/internal/color"
+	"gcm/internal/gitrepo"
 	"strings"
 	"testing"
 )
@@ -61,3 +63,42 @@ func addSomeFakeCounts(mockModel *GitLabCloneViewModel) {
 	mockModel.CloneCount.Add(30)
 	mockModel.ArchivedCloneCounter.Add(5)
 }
+
+func TestCloneView_RenderAdaptiveRate(t *testing.T) {
+	viewModel := NewGitLabCloneViewModel("testing.123", "localtest")
+	viewModel.SetAdaptiveCloneRate(gitrepo.NewAdaptiveCloneRate(channel.NewLimiter(3.5, 1), 7))
+
+	var buf bytes.Buffer
+	lineCount := NewGitLabCloneView(&buf, func() []*GitLabCloneViewModel {
+		return []*GitLabCloneViewModel{viewModel}
+	}).Render(80)
+
+	expected := fmt.Sprintf("    %s clones per second (adaptive)\n", color.FgMagenta("3.5"))
+	if !strings.HasSuffix(buf.String(), expected) {
+		t.Errorf("expected output to end with %q, got %q", expected, buf.String())
+	}
+	if lineCount != 6 {
+		t.Errorf("expected 6 lines, got %d", lineCount)
+	}
+}
+
+func TestCloneView_RendersWhileHostsAreAdded(t *testing.T) {
+	vm := NewCloneCommandViewModel()
+	cloneView := NewGitLabCloneView(&bytes.Buffer{}, vm.getGitLabCloneViewModels)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 10 {
+			hostViewModel := vm.AddGitLabCloneVM(fmt.Sprintf("gitlab%d.example.com", i), "localtest")
+			hostViewModel.SetAdaptiveCloneRate(gitrepo.NewAdaptiveCloneRate(channel.NewLimiter(1, 1), 2))
+		}
+	}()
+	for range 100 {
+		cloneView.Render(80)
+	}
+	<-done
+
+	if lineCount := cloneView.Render(80); lineCount != 60 {
+		t.Errorf("expected 6 lines for each of the 10 hosts, got %d", lineCount)
+	}
+}
@@ -0,0 +1,102 @@
+package fetchCommand
+
+import (
+	"context"
+	"fmt"
+	"gcm/internal/appConfig"
+	"gcm/internal/channel"
+	"gcm/internal/counter"
+	"gcm/internal/gitrepo"
+	logger "gcm/internal/log"
+	"gcm/internal/view"
+	"gcm/internal/workspace"
+	"github.com/samber/lo"
+	"os"
+	"time"
+)
+
+// DefaultWorkers Fetches run at the same time, fetching waits for the network most of the time
+const DefaultWorkers = 8
+
+type FetchCommandViewModel struct {
+	FetchingCount  *counter.Counter
+	FetchedCount   *counter.Counter
+	FailedCount    *counter.Counter
+	ErrorViewModel *view.ErrorViewModel
+}
+
+func NewFetchCommandViewModel() *FetchCommandViewModel {
+	return &FetchCommandViewModel{
+		FetchingCount:  counter.NewCounter(),
+		FetchedCount:   counter.NewCounter(),
+		FailedCount:    counter.NewCounter(),
+		ErrorViewModel: view.NewErrorViewModel(logger.GetLogFilePath()),
+	}
+}
+
+func NewFetchCommandView(vm *FetchCommandViewModel) view.View {
+	out := os.Stdout
+	compositeView := view.NewCompositeView([]view.View{
+		view.NewCounterView(
+			out, "%s fetching, %s working copies fetched, %s failed",
+			vm.FetchingCount, vm.FetchedCount, vm.FailedCount,
+		),
+	})
+	compositeView.AddFooter(view.NewErrorView(vm.ErrorViewModel, out))
+	compositeView.AddFooter(view.NewTimeElapsedView(time.Now(), out, time.Since))
+	return compositeView
+}
+
+// ExecuteFetchCommand fetches every working copy with prune, starting fetches at the rate limit of their host and
+// running at most workers of them at the same time. Checked out files are not changed. When ctx is done no more
+// fetches start.
+func ExecuteFetchCommand(
+	ctx context.Context,
+	config *appConfig.AppConfig,
+	backend gitrepo.Backend,
+	options gitrepo.FetchOptions,
+	workers int,
+	errorChannel chan error,
+	vm *FetchCommandViewModel,
+) {
+	var hostChannels []<-chan gitrepo.GitRepo
+	for _, gitLabConfig := range config.GitLab {
+		repositories := workspace.Cloned(workspace.HostRepositories(ctx, gitLabConfig, backend, errorChannel), errorChannel)
+		hostChannels = append(hostChannels, channel.RateLimit(
+			ctx, repositories, gitLabConfig.NewCloneLimiter(), appConfig.DefaultChannelBufferLength,
+		))
+	}
+	FetchRepositories(
+		ctx, lo.FanIn(appConfig.DefaultChannelBufferLength, hostChannels...), options, workers, errorChannel, vm,
+	)
+}
+
+// FetchRepositories fetches repositories with a pool of workers. Once ctx is done the remaining repositories are
+// drained without fetching.
+func FetchRepositories(
+	ctx context.Context,
+	repositories <-chan gitrepo.GitRepo,
+	options gitrepo.FetchOptions,
+	workers int,
+	errorChannel chan error,
+	vm *FetchCommandViewModel,
+) {
+	fetched := channel.Parallel(repositories, workers, func(repo gitrepo.GitRepo) (struct{}, bool) {
+		if ctx.Err() != nil {
+			return struct{}{}, false
+		}
+		vm.FetchingCount.Add(1)
+		err := repo.Fetch(options)
+		vm.FetchingCount.Add(-1)
+		if err != nil {
+			vm.FailedCount.Add(1)
+			errorChannel <- fmt.Errorf("failed to fetch %s: %v", repo.GetName(), err)
+			return struct{}{}, false
+		}
+		vm.FetchedCount.Add(1)
+		return struct{}{}, false
+	}, 0)
+	// Nothing is passed on, the output closes once every repository is done
+	for range fetched {
+	}
+}
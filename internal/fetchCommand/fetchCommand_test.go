@@ -0,0 +1,65 @@
+package fetchCommand
+
+import (
+	"context"
+	"fmt"
+	"gcm/internal/appConfig"
+	"gcm/internal/gitlab"
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestExecuteFetchCommand(t *testing.T) {
+	t.Setenv("GCM_TEST_TOKEN", "secret")
+	cloneDirectory := t.TempDir()
+	gitLabConfig := gitlab.GitLabConfig{
+		EnvTokenVariableName: "GCM_TEST_TOKEN",
+		HostName:             "gitlab.example.com",
+		CloneDirectory:       cloneDirectory,
+		RateLimitPerSecond:   100,
+	}
+	backend := gitrepo.NewFakeBackend()
+	for i := range 5 {
+		project := gitremote.GitRemoteProjectConfig{Name: fmt.Sprintf("app%d", i), FullPath: fmt.Sprintf("team/app%d", i)}
+		gitLabConfig.Projects = append(gitLabConfig.Projects, project)
+		backend.AddRemote("git@gitlab.example.com:"+project.FullPath, gitrepo.FakeRemote{Branches: []string{"main"}})
+		if i == 4 {
+			// Not cloned, not fetched
+			continue
+		}
+		repo := gitrepo.CreateFromGitRemoteConfig(project, gitLabConfig.HostName, cloneDirectory, "", backend)
+		if err := repo.Clone(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Cloned, but origin went away
+	_ = backend.SetRemoteURL(path.Join(cloneDirectory, "team", "app3"), gitrepo.OriginRemote, "git@gitlab.example.com:gone")
+	config := &appConfig.AppConfig{GitLab: []gitlab.GitLabConfig{gitLabConfig}}
+	vm := NewFetchCommandViewModel()
+	errorChannel := make(chan error, 10)
+
+	ExecuteFetchCommand(context.Background(), config, backend, gitrepo.FetchOptions{Prune: true}, 2, errorChannel, vm)
+	close(errorChannel)
+
+	if fetched, failed := vm.FetchedCount.Count(), vm.FailedCount.Count(); fetched != 3 || failed != 1 {
+		t.Errorf("expected 3 fetched and 1 failed, got %d fetched and %d failed", fetched, failed)
+	}
+	if fetching := vm.FetchingCount.Count(); fetching != 0 {
+		t.Errorf("expected no fetch running when done, got %d", fetching)
+	}
+	for i := range 3 {
+		count, err := backend.FetchCount(path.Join(cloneDirectory, "team", fmt.Sprintf("app%d", i)))
+		if err != nil || count != 1 {
+			t.Errorf("expected app%d fetched once, got %d, %v", i, count, err)
+		}
+	}
+	if _, err := os.Stat(path.Join(cloneDirectory, "team", "app4")); !os.IsNotExist(err) {
+		t.Errorf("expected fetch not to clone")
+	}
+	if err := <-errorChannel; err == nil {
+		t.Errorf("expected error fetching app3")
+	}
+}
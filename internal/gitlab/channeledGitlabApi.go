@@ -1,6 +1,7 @@
 package gitlab
 
 import (
+	"context"
 	"fmt"
 	"gcm/internal/counter"
 	"gcm/internal/gitrepo"
@@ -13,27 +14,33 @@ const GroupChannelBufferSize = 20
 const ProjectChannelBufferSize = 20
 
 type ChanneledApi struct {
+	ctx            context.Context // No more API requests are made when done
 	api            *APIClient
 	config         *GitLabConfig
 	projectCounter *counter.Counter
 	groupCounter   *counter.Counter
+	report         *gitrepo.RunReport // Groups whose projects could not be fetched are recorded as failed, may be nil
 	errorChannel   chan error
 }
 
 // NEXT: ADD Reporting counters and error channel handler...
 
 func NewChanneledApi(
+	ctx context.Context,
 	repo *APIClient,
 	config *GitLabConfig,
 	projectCounter *counter.Counter,
 	groupCounter *counter.Counter,
+	report *gitrepo.RunReport,
 	errorChannel chan error,
 ) *ChanneledApi {
 	return &ChanneledApi{
+		ctx:            ctx,
 		api:            repo,
 		config:         config,
 		projectCounter: projectCounter,
 		groupCounter:   groupCounter,
+		report:         report,
 		errorChannel:   errorChannel,
 	}
 }
@@ -43,9 +50,14 @@ func (channeledApi *ChanneledApi) fetchProjectsForGroup(
 	rootGroupConfig *GroupConfig,
 	projectChannel chan Project,
 ) {
-	projects, err := channeledApi.api.fetchProjects(group)
+	if err := channeledApi.ctx.Err(); err != nil {
+		channeledApi.groupFailed(group.path(), err)
+		return
+	}
+	projects, err := channeledApi.api.fetchProjects(channeledApi.ctx, group)
 	if err != nil {
-		channeledApi.errorChannel <- fmt.Errorf("failed to fetch projects for group %s: %v", group.Name, err)
+		channeledApi.groupFailed(group.path(), fmt.Errorf("failed to fetch projects: %w", err))
+		channeledApi.errorChannel <- fmt.Errorf("failed to fetch projects for group %s: %w", group.Name, err)
 		return
 	}
 	for _, project := range projects {
@@ -57,10 +69,18 @@ func (channeledApi *ChanneledApi) fetchProjectsForGroup(
 	}
 }
 
-func (channeledApi *ChanneledApi) channelSubgroups(groupId string, gwg *sync.WaitGroup, groupChannel chan *Group) {
-	subgroups, err := channeledApi.api.fetchSubgroups(groupId)
+func (channeledApi *ChanneledApi) channelSubgroups(group *Group, gwg *sync.WaitGroup, groupChannel chan *Group) {
+	// Matching add is where group is sent to channel
+	defer gwg.Done()
+	if err := channeledApi.ctx.Err(); err != nil {
+		channeledApi.groupFailed(group.path(), err)
+		return
+	}
+	groupId := fmt.Sprintf("%d", group.ID)
+	subgroups, err := channeledApi.api.fetchSubgroups(channeledApi.ctx, groupId)
 	if err != nil {
-		channeledApi.errorChannel <- fmt.Errorf("failed to fetch subgroups for group %s: %v", groupId, err)
+		channeledApi.groupFailed(group.path(), fmt.Errorf("failed to fetch subgroups: %w", err))
+		channeledApi.errorChannel <- fmt.Errorf("failed to fetch subgroups for group %s: %w", groupId, err)
 		return
 	}
 	for _, subgroup := range subgroups {
@@ -69,8 +89,16 @@ func (channeledApi *ChanneledApi) channelSubgroups(groupId string, gwg *sync.Wai
 			groupChannel <- &subgroup
 		}()
 	}
-	// Matching add is where group is sent to channel
-	gwg.Done()
+}
+
+// groupFailed records a group whose projects are not known, in place of its projects
+func (channeledApi *ChanneledApi) groupFailed(groupPath string, err error) {
+	channeledApi.report.RecordFailed(gitrepo.RunReportEntry{
+		HostName:          channeledApi.config.HostName,
+		Group:             groupPath,
+		Name:              groupPath,
+		PathWithNamespace: groupPath,
+	}, err)
 }
 
 func (channeledApi *ChanneledApi) channelGroups(
@@ -81,13 +109,15 @@ func (channeledApi *ChanneledApi) channelGroups(
 	gwg := sync.WaitGroup{}
 	groupWorkList := make(chan *Group, GroupChannelBufferSize)
 
-	rootGroup, err := channeledApi.api.fetchGroupInfo(rootGroupConfig.Name)
+	rootGroup, err := channeledApi.api.fetchGroupInfo(channeledApi.ctx, rootGroupConfig.Name)
 	if err != nil {
+		channeledApi.groupFailed(rootGroupConfig.Name, fmt.Errorf("failed to fetch group info: %w", err))
 		channeledApi.errorChannel <- fmt.Errorf(
-			"failed to fetch rootGroupConfig info for rootGroupConfig %s: %v",
+			"failed to fetch rootGroupConfig info for rootGroupConfig %s: %w",
 			rootGroupConfig.Name,
 			err,
 		)
+		close(subGroupsChannel)
 		return
 	}
 
@@ -96,8 +126,7 @@ func (channeledApi *ChanneledApi) channelGroups(
 
 	go func() {
 		// Start by adding root group to the work list
-		groupId := rootGroup.ID
-		channeledApi.channelSubgroups(fmt.Sprintf("%d", groupId), &gwg, groupWorkList)
+		channeledApi.channelSubgroups(rootGroup, &gwg, groupWorkList)
 	}()
 
 	go func() {
@@ -107,8 +136,7 @@ func (channeledApi *ChanneledApi) channelGroups(
 				break
 			}
 			subGroupsChannel <- receivedGroup
-			groupId := receivedGroup.ID
-			channeledApi.channelSubgroups(fmt.Sprintf("%d", groupId), &gwg, groupWorkList)
+			channeledApi.channelSubgroups(receivedGroup, &gwg, groupWorkList)
 		}
 		close(subGroupsChannel)
 	}()
@@ -155,7 +183,18 @@ func (channeledApi *ChanneledApi) ScheduleGitlabGroupProjectsFetch(groups []Grou
 	return lo.FanIn(ProjectChannelBufferSize, projectChannels...)
 }
 
-func ConvertProjectsToRepos(gitlabProjectChannel <-chan Project) chan gitrepo.GitRepo {
+// ScheduleRepositories channels every repository configured for the host, both group projects and direct projects
+func (channeledApi *ChanneledApi) ScheduleRepositories(
+	directProjectCounter *counter.Counter,
+	backend gitrepo.Backend,
+) <-chan gitrepo.GitRepo {
+	remoteRepoChannel := channeledApi.ScheduleDirectProjects(directProjectCounter, backend)
+	gitlabGroupProjectsChannel := channeledApi.ScheduleGitlabGroupProjectsFetch(channeledApi.config.Groups)
+	reposChannel := ConvertProjectsToRepos(gitlabGroupProjectsChannel, backend)
+	return lo.FanIn[gitrepo.GitRepo](ProjectChannelBufferSize, reposChannel, remoteRepoChannel)
+}
+
+func ConvertProjectsToRepos(gitlabProjectChannel <-chan Project, backend gitrepo.Backend) chan gitrepo.GitRepo {
 	gitRepoChannel := make(chan gitrepo.GitRepo, 10)
 
 	go func() {
@@ -164,21 +203,19 @@ func ConvertProjectsToRepos(gitlabProjectChannel <-chan Project) chan gitrepo.Gi
 			if !ok {
 				break
 			}
-			gitRepo := gitrepo.GitRepository{
-				Name:              receivedProject.Name,
-				SSHURLToRepo:      receivedProject.SSHURLToRepo,
-				PathWithNamespace: receivedProject.PathWithNamespace,
-				Archived:          receivedProject.Archived,
-				CloneOptions:      receivedProject,
-			}
-			gitRepoChannel <- &gitRepo
+			gitRepoChannel <- receivedProject.ToRepository(backend)
 		}
 		close(gitRepoChannel)
 	}()
 	return gitRepoChannel
 }
 
-func (channeledApi *ChanneledApi) ScheduleDirectProjects(projectCounter *counter.Counter) chan gitrepo.GitRepo {
+// ScheduleDirectProjects channels the projects configured directly. Once ctx is done the remaining ones are recorded as
+// failed instead.
+func (channeledApi *ChanneledApi) ScheduleDirectProjects(
+	projectCounter *counter.Counter,
+	backend gitrepo.Backend,
+) chan gitrepo.GitRepo {
 	repoChannel := make(chan gitrepo.GitRepo, GroupChannelBufferSize)
 	go func() {
 		for _, prj := range channeledApi.config.Projects {
@@ -186,7 +223,14 @@ func (channeledApi *ChanneledApi) ScheduleDirectProjects(projectCounter *counter
 				prj,
 				channeledApi.config.HostName,
 				channeledApi.config.CloneDirectory,
+				channeledApi.config.Layout,
+				backend,
 			)
+			repo.ReferenceCache = channeledApi.config.ReferenceCache
+			if err := channeledApi.ctx.Err(); err != nil {
+				channeledApi.report.Record(repo, gitrepo.OutcomeFailed, 0, err)
+				continue
+			}
 			projectCounter.Add(1)
 			repoChannel <- repo
 		}
@@ -0,0 +1,39 @@
+package gitlab
+
+import (
+	"context"
+	"gcm/internal/counter"
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
+	"slices"
+	"testing"
+)
+
+func TestChanneledApi_RecordsWhatIsNotScheduledAsFailed(t *testing.T) {
+	config := &GitLabConfig{
+		HostName: "gitlab.example.com",
+		Groups:   []GroupConfig{{Name: "team"}},
+		Projects: []gitremote.GitRemoteProjectConfig{{Name: "tool", FullPath: "other/tool"}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report := gitrepo.NewRunReport()
+	errorChannel := make(chan error, 10)
+	channeledApi := NewChanneledApi(
+		ctx, NewAPIClient("secret", *config), config, counter.NewCounter(), counter.NewCounter(), report, errorChannel,
+	)
+
+	for range channeledApi.ScheduleRepositories(counter.NewCounter(), nil) {
+		t.Error("expected no repositories once cancelled")
+	}
+
+	var failed []string
+	for _, entry := range report.Entries() {
+		if entry.Outcome == gitrepo.OutcomeFailed {
+			failed = append(failed, entry.Name)
+		}
+	}
+	if !slices.Equal(failed, []string{"team", "tool"}) {
+		t.Errorf("expected group team and project tool to be recorded as failed, got %v", failed)
+	}
+}
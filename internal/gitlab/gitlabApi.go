@@ -1,28 +1,62 @@
 package gitlab
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gcm/internal/ext"
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
 	"gcm/internal/log"
 	"io"
 	"net/http"
 )
 
 type Group struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	FullPath string `json:"full_path"` // Path with the paths of all parent groups, e.g. group/subgroup
+}
+
+// path is the full path of the group, or its name when GitLab did not tell the path
+func (g *Group) path() string {
+	return ext.DefaultValue(g.FullPath, g.Name)
+}
+
+// groupPath is the full path of the group a project is in, empty when it is not known
+func (p Project) groupPath() string {
+	if p.Group == nil {
+		return ""
+	}
+	return p.Group.FullPath
 }
 
 type Project struct {
-	Name              string `json:"name"`
-	SSHURLToRepo      string `json:"ssh_url_to_repo"`
-	PathWithNamespace string `json:"path_with_namespace"`
-	Archived          bool   `json:"archived"`
+	ID                int            `json:"id"`
+	Name              string         `json:"name"`
+	SSHURLToRepo      string         `json:"ssh_url_to_repo"`
+	PathWithNamespace string         `json:"path_with_namespace"`
+	Archived          bool           `json:"archived"`
+	ForkedFromProject *ForkedProject `json:"forked_from_project"` // nil when the project is not a fork
 	Group             *Group
 	GroupConfig       *GroupConfig
 	GitLabConfig      *GitLabConfig
 }
 
+// ForkedProject The project a fork was created from
+type ForkedProject struct {
+	SSHURLToRepo string `json:"ssh_url_to_repo"`
+}
+
+// ForkOf is the URL of the project this one is a fork of, empty when it is not a fork
+func (p Project) ForkOf() string {
+	if p.ForkedFromProject == nil {
+		return ""
+	}
+	return p.ForkedFromProject.SSHURLToRepo
+}
+
 func (p Project) CloneArchived() bool {
 	cloneArchived := p.GroupConfig.CloneArchived
 	return cloneArchived
@@ -32,6 +66,35 @@ func (p Project) CloneRootDirectory() string {
 	return p.GitLabConfig.CloneDirectory
 }
 
+func (p Project) Layout() string {
+	return ext.DefaultValue(p.GroupConfig.Layout, p.GitLabConfig.Layout)
+}
+
+func (p Project) CloneConfig() gitremote.CloneConfig {
+	return p.GroupConfig.CloneConfig
+}
+
+// ToRepository converts a project of a configured group to the repository gcm manages
+func (p Project) ToRepository(backend gitrepo.Backend) *gitrepo.GitRepository {
+	return &gitrepo.GitRepository{
+		Name:              p.Name,
+		SSHURLToRepo:      p.SSHURLToRepo,
+		PathWithNamespace: p.PathWithNamespace,
+		GroupPath:         p.groupPath(),
+		Archived:          p.Archived,
+		ArchivedKnown:     true,
+		CloneOptions:      p,
+		Backend:           backend,
+		ReferenceCache:    p.GitLabConfig.ReferenceCache,
+		ForkOf:            p.ForkOf(),
+		ProjectID:         p.ID,
+		HostName:          p.GitLabConfig.HostName,
+	}
+}
+
+// ErrNotAuthenticated GitLab was not asked, or refused, because the token is missing, invalid or lacks permissions
+var ErrNotAuthenticated = errors.New("not authenticated")
+
 /* Repository API manages access to the Gitlab API.
 It adheres to the Repository pattern as well - it is at the boundary to external data (Gitlab API).
 All methods should be synchronous - channels and pipes handled in other classes/methods.
@@ -40,12 +103,15 @@ All methods should be synchronous - channels and pipes handled in other classes/
 type APIClient struct {
 	hostName string
 	token    string
+	limiter  *requestLimiter
 }
 
-func NewAPIClient(token, hostName string) *APIClient {
+// NewAPIClient creates a client for the host of gitLabConfig, keeping its requests within the API limits configured
+func NewAPIClient(token string, gitLabConfig GitLabConfig) *APIClient {
 	return &APIClient{
-		hostName: hostName,
+		hostName: gitLabConfig.HostName,
 		token:    token,
+		limiter:  newRequestLimiter(gitLabConfig.NewApiLimiter(), gitLabConfig.GetConfiguredMaxConcurrentApiRequests()),
 	}
 }
 
@@ -53,25 +119,30 @@ func (apiClient APIClient) url() string {
 	return fmt.Sprintf("https://%s/api/v4", apiClient.hostName)
 }
 
-func (apiClient APIClient) fetchProjects(group *Group) ([]Project, error) {
-	return gitlabGet[[]Project](apiClient.token, fmt.Sprintf("%s/groups/%d/projects", apiClient.url(), group.ID))
+func (apiClient APIClient) fetchProjects(ctx context.Context, group *Group) ([]Project, error) {
+	return gitlabGet[[]Project](ctx, apiClient, fmt.Sprintf("%s/groups/%d/projects", apiClient.url(), group.ID))
 }
 
-func (apiClient APIClient) fetchSubgroups(groupID string) ([]Group, error) {
-	return gitlabGet[[]Group](apiClient.token, fmt.Sprintf("%s/groups/%s/subgroups", apiClient.url(), groupID))
+func (apiClient APIClient) fetchSubgroups(ctx context.Context, groupID string) ([]Group, error) {
+	return gitlabGet[[]Group](ctx, apiClient, fmt.Sprintf("%s/groups/%s/subgroups", apiClient.url(), groupID))
 }
 
-func (apiClient APIClient) fetchGroupInfo(groupID string) (*Group, error) {
-	return gitlabGet[*Group](apiClient.token, fmt.Sprintf("%s/groups/%s", apiClient.url(), groupID))
+func (apiClient APIClient) fetchGroupInfo(ctx context.Context, groupID string) (*Group, error) {
+	return gitlabGet[*Group](ctx, apiClient, fmt.Sprintf("%s/groups/%s", apiClient.url(), groupID))
 }
 
-func gitlabGet[T any](token string, url string) (T, error) {
+func gitlabGet[T any](ctx context.Context, apiClient APIClient, url string) (T, error) {
 	var emptyResult T
-	req, err := http.NewRequest("GET", url, nil)
+	if err := apiClient.limiter.acquire(ctx); err != nil {
+		return emptyResult, err
+	}
+	defer apiClient.limiter.release()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return emptyResult, err
 	}
-	req.Header.Set("PRIVATE-TOKEN", token)
+	req.Header.Set("PRIVATE-TOKEN", apiClient.token)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -86,6 +157,11 @@ func gitlabGet[T any](token string, url string) (T, error) {
 		}
 	}(resp.Body)
 
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return emptyResult, fmt.Errorf(
+			"GitLab API request on %s failed with status: %s (%w)", url, resp.Status, ErrNotAuthenticated,
+		)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return emptyResult, fmt.Errorf("GitLab API request on %s failed with status: %s", url, resp.Status)
 	}
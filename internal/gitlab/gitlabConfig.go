@@ -1,26 +1,55 @@
 package gitlab
 
 import (
+	"fmt"
+	"gcm/internal/channel"
 	"gcm/internal/ext"
 	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
 	"os"
+	"strings"
+	"time"
 )
 
 // This rate is tested to minimise error rate on cloning 250 repositories.
 const DefaultGitlabRateLimit = 7
 
+// DefaultCloneRetries Retries of clones failing with a transient error, unless configured
+const DefaultCloneRetries = 2
+
+// CloneRetryBackoff Wait before the first retry of a clone
+const CloneRetryBackoff = 5 * time.Second
+
+// DefaultApiRateLimit API requests per second to a host, well below the limits of gitlab.com
+const DefaultApiRateLimit = 10
+
+// DefaultMaxConcurrentApiRequests API requests to a host waiting for a response at the same time
+const DefaultMaxConcurrentApiRequests = 4
+
 type GitLabConfig struct {
-	EnvTokenVariableName string                             `yaml:"tokenEnvVar"`    // The environment variable name for the GitLab token
-	HostName             string                             `yaml:"hostName"`       // Gitlab host name
-	CloneDirectory       string                             `yaml:"cloneDirectory"` // Where to clone projects in local directory structure
-	Groups               []GroupConfig                      `yaml:"groups"`
-	Projects             []gitremote.GitRemoteProjectConfig `yaml:"projects"`
-	RateLimitPerSecond   int                                `yaml:"rateLimitPerSecond"` // 0 is interpreted as no limit
+	EnvTokenVariableName     string                             `yaml:"tokenEnvVar"`    // The environment variable name for the GitLab token
+	HostName                 string                             `yaml:"hostName"`       // Gitlab host name
+	CloneDirectory           string                             `yaml:"cloneDirectory"` // Where to clone projects in local directory structure
+	Groups                   []GroupConfig                      `yaml:"groups"`
+	Projects                 []gitremote.GitRemoteProjectConfig `yaml:"projects"`
+	RateLimitPerSecond       int                                `yaml:"rateLimitPerSecond"`       // Clones started per second, 0 for the default, negative for no limit
+	RateLimitBurst           int                                `yaml:"rateLimitBurst"`           // Clones started at once after a quiet period, 0 for 1
+	Layout                   string                             `yaml:"layout"`                   // Working copy path template, see gitrepo.LayoutData
+	ReferenceCache           string                             `yaml:"referenceCache"`           // Directory with bare mirrors shared by clones, none when empty
+	MaxConcurrentClones      int                                `yaml:"maxConcurrentClones"`      // Clones of this host at the same time, 0 for only the global limit
+	AdaptiveRateLimit        bool                               `yaml:"adaptiveRateLimit"`        // Adapt the clone rate to SSH connection failures
+	MaxRateLimitPerSecond    int                                `yaml:"maxRateLimitPerSecond"`    // Highest adaptive clone rate, 0 for twice rateLimitPerSecond
+	CloneRetries             int                                `yaml:"cloneRetries"`             // Retries of clones failing with a transient error, 0 for the default, negative for none
+	ApiRateLimitPerSecond    int                                `yaml:"apiRateLimitPerSecond"`    // API requests started per second, 0 for the default, negative for no limit
+	ApiRateLimitBurst        int                                `yaml:"apiRateLimitBurst"`        // API requests started at once after a quiet period, 0 for 1
+	MaxConcurrentApiRequests int                                `yaml:"maxConcurrentApiRequests"` // API requests in flight at the same time, 0 for the default, at least 1
 }
 
 type GroupConfig struct {
-	Name          string `yaml:"name"`
-	CloneArchived bool   `yaml:"cloneArchived"`
+	Name                  string `yaml:"name"`
+	CloneArchived         bool   `yaml:"cloneArchived"`
+	Layout                string `yaml:"layout"` // Overrides the layout of the host for projects in the group
+	gitremote.CloneConfig `yaml:",inline"`
 }
 
 func (gitLabConfig GitLabConfig) RetrieveTokenFromEnv() string {
@@ -28,6 +57,103 @@ func (gitLabConfig GitLabConfig) RetrieveTokenFromEnv() string {
 	return token
 }
 
+// HasCustomLayout tells whether working copies may be placed somewhere else than their full path with namespace
+func (gitLabConfig GitLabConfig) HasCustomLayout() bool {
+	if gitLabConfig.Layout != "" {
+		return true
+	}
+	for _, group := range gitLabConfig.Groups {
+		if group.Layout != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateLayouts checks the layout templates of the host and its groups
+func (gitLabConfig GitLabConfig) ValidateLayouts() error {
+	if err := gitrepo.ValidateLayout(gitLabConfig.Layout); err != nil {
+		return fmt.Errorf("%s: %v", gitLabConfig.HostName, err)
+	}
+	for _, group := range gitLabConfig.Groups {
+		if err := gitrepo.ValidateLayout(group.Layout); err != nil {
+			return fmt.Errorf("%s group %s: %v", gitLabConfig.HostName, group.Name, err)
+		}
+	}
+	return nil
+}
+
+// MissingTokenError describes why a host without a token in the environment is skipped
+func (gitLabConfig GitLabConfig) MissingTokenError() error {
+	return fmt.Errorf(
+		"Gitlab token env variable %s not set for %s; skipping (%w)",
+		gitLabConfig.EnvTokenVariableName,
+		gitLabConfig.HostName,
+		ErrNotAuthenticated,
+	)
+}
+
 func (gitLabConfig GitLabConfig) GetConfiguredCloneRate() int {
 	return ext.DefaultValue(gitLabConfig.RateLimitPerSecond, DefaultGitlabRateLimit)
 }
+
+func (gitLabConfig GitLabConfig) GetConfiguredApiRate() int {
+	return ext.DefaultValue(gitLabConfig.ApiRateLimitPerSecond, DefaultApiRateLimit)
+}
+
+func (gitLabConfig GitLabConfig) GetConfiguredCloneRetries() gitrepo.CloneRetries {
+	return gitrepo.CloneRetries{
+		Max:     max(ext.DefaultValue(gitLabConfig.CloneRetries, DefaultCloneRetries), 0),
+		Backoff: CloneRetryBackoff,
+	}
+}
+
+// NewCloneLimiter limits how fast clones of the host start
+func (gitLabConfig GitLabConfig) NewCloneLimiter() *channel.Limiter {
+	return channel.NewLimiter(float64(gitLabConfig.GetConfiguredCloneRate()), gitLabConfig.RateLimitBurst)
+}
+
+// NewAdaptiveCloneRate adapts the rate of a limiter from NewCloneLimiter, nil when the rate is not adaptive
+func (gitLabConfig GitLabConfig) NewAdaptiveCloneRate(cloneLimiter *channel.Limiter) *gitrepo.AdaptiveCloneRate {
+	if !gitLabConfig.AdaptiveRateLimit {
+		return nil
+	}
+	maxRate := ext.DefaultValue(gitLabConfig.MaxRateLimitPerSecond, 2*gitLabConfig.GetConfiguredCloneRate())
+	return gitrepo.NewAdaptiveCloneRate(cloneLimiter, float64(maxRate))
+}
+
+// NewApiLimiter limits how fast API requests to the host start
+func (gitLabConfig GitLabConfig) NewApiLimiter() *channel.Limiter {
+	return channel.NewLimiter(float64(gitLabConfig.GetConfiguredApiRate()), gitLabConfig.ApiRateLimitBurst)
+}
+
+func (gitLabConfig GitLabConfig) GetConfiguredMaxConcurrentApiRequests() int {
+	return ext.DefaultValue(gitLabConfig.MaxConcurrentApiRequests, DefaultMaxConcurrentApiRequests)
+}
+
+// ConfiguredRepository places a project known from elsewhere, e.g. a bundle manifest, like the configuration would
+// place it when cloning, without asking GitLab. Projects configured directly are matched by path, group projects by
+// the path of the group they are in. Projects matching neither get the host layout and default clone options.
+func (gitLabConfig *GitLabConfig) ConfiguredRepository(project Project, backend gitrepo.Backend) *gitrepo.GitRepository {
+	for _, directProject := range gitLabConfig.Projects {
+		if directProject.FullPath == project.PathWithNamespace {
+			repo := gitrepo.CreateFromGitRemoteConfig(
+				directProject, gitLabConfig.HostName, gitLabConfig.CloneDirectory, gitLabConfig.Layout, backend,
+			)
+			repo.SSHURLToRepo = ext.DefaultValue(project.SSHURLToRepo, repo.SSHURLToRepo)
+			repo.ProjectID = project.ID
+			repo.ReferenceCache = gitLabConfig.ReferenceCache
+			return repo
+		}
+	}
+
+	project.GroupConfig = &GroupConfig{}
+	for i, group := range gitLabConfig.Groups {
+		inGroup := strings.HasPrefix(project.PathWithNamespace, group.Name+"/")
+		if inGroup && len(group.Name) > len(project.GroupConfig.Name) {
+			project.GroupConfig = &gitLabConfig.Groups[i]
+		}
+	}
+	project.GitLabConfig = gitLabConfig
+	return project.ToRepository(backend)
+}
@@ -0,0 +1,14 @@
+package gitlab
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMissingTokenError_IsNotAuthenticated(t *testing.T) {
+	err := GitLabConfig{EnvTokenVariableName: "GITLAB_TOKEN", HostName: "gitlab.example.com"}.MissingTokenError()
+
+	if !errors.Is(err, ErrNotAuthenticated) {
+		t.Errorf("expected %v to be an authentication error", err)
+	}
+}
@@ -0,0 +1,37 @@
+package gitlab
+
+import (
+	"context"
+	"gcm/internal/channel"
+)
+
+// requestLimiter limits how fast API requests to a host start and how many are in flight at the same time
+type requestLimiter struct {
+	rate     *channel.Limiter
+	inFlight chan struct{}
+}
+
+func newRequestLimiter(rate *channel.Limiter, maxInFlight int) *requestLimiter {
+	return &requestLimiter{
+		rate:     rate,
+		inFlight: make(chan struct{}, max(maxInFlight, 1)),
+	}
+}
+
+// acquire waits until a request may start, every successful acquire needs a release when the request is done
+func (limiter *requestLimiter) acquire(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case limiter.inFlight <- struct{}{}:
+	}
+	if err := limiter.rate.Wait(ctx); err != nil {
+		limiter.release()
+		return err
+	}
+	return nil
+}
+
+func (limiter *requestLimiter) release() {
+	<-limiter.inFlight
+}
@@ -0,0 +1,75 @@
+package gitlab
+
+import (
+	"context"
+	"gcm/internal/channel"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestLimiter_BoundsRequestsInFlight(t *testing.T) {
+	limiter := newRequestLimiter(channel.NewLimiter(1000, 1), 2)
+	var running, peak atomic.Int32
+	var waitGroup sync.WaitGroup
+	for range 10 {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			if err := limiter.acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			defer limiter.release()
+			current := running.Add(1)
+			for old := peak.Load(); current > old && !peak.CompareAndSwap(old, current); old = peak.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	waitGroup.Wait()
+
+	if peak.Load() > 2 {
+		t.Errorf("expected at most 2 requests in flight, got %d", peak.Load())
+	}
+}
+
+func TestRequestLimiter_SpacesRequestsToRate(t *testing.T) {
+	limiter := newRequestLimiter(channel.NewLimiter(100, 1), 10)
+	start := time.Now()
+	for range 5 {
+		if err := limiter.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		limiter.release()
+	}
+
+	// The first request starts at once, the other four 10ms apart
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected 5 requests at 100 per second to take at least 40ms, took %v", elapsed)
+	}
+}
+
+func TestRequestLimiter_StopsWaitingWhenCancelled(t *testing.T) {
+	limiter := newRequestLimiter(channel.NewLimiter(1, 1), 1)
+	if err := limiter.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.acquire(ctx); err == nil {
+		t.Error("expected an error when the context is done while waiting")
+	}
+}
+
+func TestRequestLimiter_AllowsOneRequestWhenConfiguredBelowOne(t *testing.T) {
+	limiter := newRequestLimiter(channel.NewLimiter(0, 1), -1)
+
+	if err := limiter.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	limiter.release()
+}
@@ -2,6 +2,29 @@ package gitremote
 
 // GitRemoteProjectConfig Configuration that points directly to a remote project. Not dependent on type of RepoManager, but needs HostName from RepoManager for full config.
 type GitRemoteProjectConfig struct {
-	Name     string `yaml:"name"`
-	FullPath string `yaml:"fullPath"`
+	Name        string `yaml:"name"`
+	FullPath    string `yaml:"fullPath"`
+	CloneConfig `yaml:",inline"`
+}
+
+// CloneConfig How to clone. Can be set for a group or a single project.
+type CloneConfig struct {
+	Depth        int    `yaml:"depth" json:"depth,omitempty"`               // Shallow clone with this many commits of history, 0 for full history
+	Filter       string `yaml:"filter" json:"filter,omitempty"`             // Partial clone filter, e.g. blob:none or tree:0
+	SingleBranch bool   `yaml:"singleBranch" json:"singleBranch,omitempty"` // Only fetch the branch that is checked out
+	Branch       string `yaml:"branch" json:"branch,omitempty"`             // Branch to check out instead of the remote HEAD
+	// Directories to check out in sparse-checkout cone mode, everything is checked out when empty
+	SparseCheckout    []string        `yaml:"sparseCheckout" json:"sparseCheckout,omitempty"`
+	RecurseSubmodules bool            `yaml:"recurseSubmodules" json:"recurseSubmodules,omitempty"` // Clone submodules along with the repository
+	ShallowSubmodules bool            `yaml:"shallowSubmodules" json:"shallowSubmodules,omitempty"` // Clone submodules with only their latest commit, implies recurseSubmodules
+	SkipLfs           bool            `yaml:"skipLfs" json:"skipLfs,omitempty"`                     // Leave Git LFS pointer files in place of LFS content, fetch it later with gcm lfs pull
+	PostClone         PostCloneConfig `yaml:"postClone" json:"postClone"`
+	// Branches, or patterns like release/*, kept checked out as git worktrees next to the working copy
+	Worktrees []string `yaml:"worktrees" json:"worktrees,omitempty"`
+}
+
+// PostCloneConfig Setup of a new working copy after it has been cloned
+type PostCloneConfig struct {
+	GitConfig map[string]string `yaml:"gitConfig" json:"gitConfig,omitempty"` // Repository git config, e.g. user.email, commit.gpgsign or core.hooksPath
+	Commands  []string          `yaml:"commands" json:"commands,omitempty"`   // Shell commands run in the working copy, e.g. make bootstrap
 }
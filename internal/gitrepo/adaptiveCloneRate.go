@@ -0,0 +1,78 @@
+package gitrepo
+
+import (
+	"gcm/internal/channel"
+	. "gcm/internal/log"
+	"sync"
+	"time"
+)
+
+// MinAdaptiveCloneRate Clones started per second the adaptive rate does not go below
+const MinAdaptiveCloneRate = 0.5
+
+// adaptiveRaiseAfter Successful clones in a row after which the adaptive rate goes up by adaptiveRaiseStep
+const adaptiveRaiseAfter = 10
+const adaptiveRaiseStep = 0.5
+
+// AdaptiveCloneRate adjusts the rate of a clone limiter to how the host copes: it halves the rate when a clone fails
+// on the SSH connection and raises it a little after every adaptiveRaiseAfter successful clones, up to maxRate.
+// Clones running together tend to fail together, so only failures of clones started after the rate was last lowered
+// lower it again. A nil AdaptiveCloneRate leaves the rate alone.
+type AdaptiveCloneRate struct {
+	mutex     sync.Mutex
+	limiter   *channel.Limiter
+	maxRate   float64
+	successes int
+	lowered   time.Time // When the rate was last lowered
+}
+
+func NewAdaptiveCloneRate(limiter *channel.Limiter, maxRate float64) *AdaptiveCloneRate {
+	return &AdaptiveCloneRate{
+		limiter: limiter,
+		maxRate: maxRate,
+	}
+}
+
+// CloneFinished adjusts the rate to the outcome of a clone started at started, err is nil for a successful clone
+func (adaptiveRate *AdaptiveCloneRate) CloneFinished(started time.Time, err error) {
+	if adaptiveRate == nil {
+		return
+	}
+	adaptiveRate.mutex.Lock()
+	defer adaptiveRate.mutex.Unlock()
+	rate := adaptiveRate.limiter.Rate()
+	if rate <= 0 {
+		// Not limited, nothing to adapt
+		return
+	}
+	if IsSSHConnectionFailure(err) {
+		adaptiveRate.successes = 0
+		if !started.After(adaptiveRate.lowered) {
+			// Failed along with the clone that lowered the rate, before the lower rate could help
+			return
+		}
+		adaptiveRate.lowered = time.Now()
+		lowered := max(rate/2, MinAdaptiveCloneRate)
+		if lowered < rate {
+			Log.Infof("Clone failed on the SSH connection, lowering the clone rate to %.1f per second", lowered)
+			adaptiveRate.limiter.SetRate(lowered)
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+	adaptiveRate.successes++
+	if adaptiveRate.successes < adaptiveRaiseAfter {
+		return
+	}
+	adaptiveRate.successes = 0
+	if raised := min(rate+adaptiveRaiseStep, adaptiveRate.maxRate); raised > rate {
+		adaptiveRate.limiter.SetRate(raised)
+	}
+}
+
+// Rate is the clone rate currently in effect, in clones started per second
+func (adaptiveRate *AdaptiveCloneRate) Rate() float64 {
+	return adaptiveRate.limiter.Rate()
+}
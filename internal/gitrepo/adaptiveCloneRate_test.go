@@ -0,0 +1,68 @@
+package gitrepo
+
+import (
+	"errors"
+	"gcm/internal/channel"
+	"testing"
+	"time"
+)
+
+var errKexReset = errors.New(
+	"exit status 128: kex_exchange_identification: read: Connection reset by peer\n" +
+		"fatal: Could not read from remote repository.",
+)
+
+func TestAdaptiveCloneRate_HalvesOnSSHFailureDownToMinimum(t *testing.T) {
+	adaptiveRate := NewAdaptiveCloneRate(channel.NewLimiter(4, 1), 8)
+
+	adaptiveRate.CloneFinished(time.Now(), errKexReset)
+	if rate := adaptiveRate.Rate(); rate != 2 {
+		t.Errorf("expected rate 2 after an SSH failure, got %v", rate)
+	}
+	for range 5 {
+		adaptiveRate.CloneFinished(time.Now(), errKexReset)
+	}
+	if rate := adaptiveRate.Rate(); rate != MinAdaptiveCloneRate {
+		t.Errorf("expected the minimum rate, got %v", rate)
+	}
+}
+
+func TestAdaptiveCloneRate_RaisesAfterSuccessesUpToMaximum(t *testing.T) {
+	adaptiveRate := NewAdaptiveCloneRate(channel.NewLimiter(4, 1), 5)
+
+	for range adaptiveRaiseAfter - 1 {
+		adaptiveRate.CloneFinished(time.Now(), nil)
+	}
+	adaptiveRate.CloneFinished(time.Now(), errors.New("repository not found"))
+	if rate := adaptiveRate.Rate(); rate != 4 {
+		t.Errorf("expected other failures to leave the rate alone, got %v", rate)
+	}
+	adaptiveRate.CloneFinished(time.Now(), nil)
+	if rate := adaptiveRate.Rate(); rate != 4.5 {
+		t.Errorf("expected rate 4.5 after %d successful clones, got %v", adaptiveRaiseAfter, rate)
+	}
+	for range 10 * adaptiveRaiseAfter {
+		adaptiveRate.CloneFinished(time.Now(), nil)
+	}
+	if rate := adaptiveRate.Rate(); rate != 5 {
+		t.Errorf("expected the maximum rate 5, got %v", rate)
+	}
+}
+
+func TestAdaptiveCloneRate_LowersOnceForClonesFailingTogether(t *testing.T) {
+	adaptiveRate := NewAdaptiveCloneRate(channel.NewLimiter(8, 1), 8)
+	started := time.Now()
+
+	// 16 clones running at the same time are reset by the host
+	for range 16 {
+		adaptiveRate.CloneFinished(started, errKexReset)
+	}
+	if rate := adaptiveRate.Rate(); rate != 4 {
+		t.Errorf("expected clones failing together to halve the rate once to 4, got %v", rate)
+	}
+
+	adaptiveRate.CloneFinished(time.Now(), errKexReset)
+	if rate := adaptiveRate.Rate(); rate != 2 {
+		t.Errorf("expected a clone started at the lower rate to halve it again to 2, got %v", rate)
+	}
+}
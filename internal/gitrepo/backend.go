@@ -0,0 +1,75 @@
+package gitrepo
+
+/* Backend is the boundary between gcm and git.
+All methods are synchronous and work on the working copy in directory - channels and pipes handled in other classes/methods.
+CliBackend runs the git executable, FakeBackend keeps repositories in memory for tests.
+*/
+
+type Backend interface {
+	// Clone clones url into directory, which must exist and be empty. flags are passed on to git clone.
+	Clone(url string, directory string, flags []string) error
+	Fetch(directory string, options FetchOptions) error
+	Status(directory string) (Status, error)
+	RemoteURL(directory string, remote string) (string, error)
+	SetRemoteURL(directory string, remote string, url string) error
+	Completeness(directory string) (Completeness, error)
+	// MakeComplete fetches everything a shallow, partial or single branch clone left out
+	MakeComplete(directory string) error
+	// SparseCheckout lists the cone mode sparse-checkout directories, nil when everything is checked out
+	SparseCheckout(directory string) ([]string, error)
+	// SetSparseCheckout checks out only directories in cone mode, or everything when directories is empty
+	SetSparseCheckout(directory string, directories []string) error
+	// LfsPull downloads Git LFS content for the checked out files
+	LfsPull(directory string) error
+	// SetConfig sets a git config value in the repository config
+	SetConfig(directory string, key string, value string) error
+	// Fsck checks that all objects reachable from refs are present
+	Fsck(directory string) error
+	// HasCommits tells whether HEAD points to a commit, false for an unborn branch
+	HasCommits(directory string) (bool, error)
+	RemoteHasCommits(directory string, remote string) (bool, error)
+	// RemoteBranches lists the branches of remote known from the latest fetch
+	RemoteBranches(directory string, remote string) ([]string, error)
+	// FetchRemoteBranches copies the remote-tracking branches of remote and all tags from the repository or bundle
+	// at source, so a working copy cloned from source tracks the same branches as the one source was made from
+	FetchRemoteBranches(directory string, source string, remote string) error
+	// Worktrees lists the paths of linked worktrees, without the main working copy
+	Worktrees(directory string) ([]string, error)
+	// AddWorktree checks out branch in a new worktree at worktreePath, tracking the remote branch of the same name
+	AddWorktree(directory string, worktreePath string, branch string) error
+	// RemoveWorktree removes a linked worktree, failing when it has uncommitted changes
+	RemoveWorktree(directory string, worktreePath string) error
+	// UpdateMirror fetches the branches of url into refs/remotes/<name>/ of the bare repository in directory,
+	// creating it when missing
+	UpdateMirror(directory string, name string, url string) error
+	// CreateBundle writes all refs to a git bundle file, which can be cloned like a remote
+	CreateBundle(directory string, bundlePath string) error
+	// RunCommand runs a shell command in directory, stopped along with git when the backend stops its processes
+	RunCommand(directory string, command string) error
+}
+
+type FetchOptions struct {
+	Prune bool
+	All   bool // Fetch all remotes, not only origin
+	Tags  bool
+}
+
+type Status struct {
+	Branch string // Empty when HEAD is detached
+	Dirty  bool   // Uncommitted changes or untracked files
+	Ahead  int    // Commits not pushed to the tracked remote branch
+	Behind int    // Commits on the tracked remote branch not merged
+}
+
+// Completeness What a clone left out of the history from origin
+type Completeness struct {
+	Shallow       bool
+	PartialFilter string // The partial clone filter, empty when all objects were fetched
+	SingleBranch  bool
+}
+
+func (c Completeness) IsComplete() bool {
+	return !c.Shallow && c.PartialFilter == "" && !c.SingleBranch
+}
+
+const OriginRemote = "origin"
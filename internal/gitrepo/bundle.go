@@ -0,0 +1,65 @@
+package gitrepo
+
+import (
+	"fmt"
+	. "gcm/internal/log"
+	"os"
+	"path"
+)
+
+// CreateBundle writes all refs of the working copy to a git bundle file, reporting false for a repository without
+// commits, which git cannot bundle
+func (repo *GitRepository) CreateBundle(bundlePath string) (bool, error) {
+	projectPath := repo.WorkingCopyPath()
+	hasCommits, err := repo.git().HasCommits(projectPath)
+	if err != nil || !hasCommits {
+		return false, err
+	}
+	if err := os.MkdirAll(path.Dir(bundlePath), os.ModePerm); err != nil {
+		return false, err
+	}
+	Log.Infof("Bundling %s into %s", projectPath, bundlePath)
+	if err := repo.git().CreateBundle(projectPath, bundlePath); err != nil {
+		return false, fmt.Errorf("in %s, creating bundle %s failed: %v", projectPath, bundlePath, err)
+	}
+	return true, nil
+}
+
+// RestoreFromBundle clones the working copy from a git bundle file without network access, with origin pointing to
+// the provider afterwards, and sets it up like a new clone. It reports false without restoring when the working copy
+// does not need cloning, because it exists or is archived while archived projects are not cloned.
+func (repo *GitRepository) RestoreFromBundle(bundlePath string) (bool, error) {
+	needsCloning, err := repo.CheckNeedsCloning()
+	if !needsCloning {
+		return false, err
+	}
+
+	projectPath := repo.WorkingCopyPath()
+	Log.Infof("Restoring %s to %s from %s", repo.Name, projectPath, bundlePath)
+	err = cloneAtomically(projectPath, func(directory string) error {
+		err := repo.git().Clone(bundlePath, directory, nil)
+		if err != nil {
+			return fmt.Errorf("in %s, git clone %s failed: %s", directory, bundlePath, err)
+		}
+		// The clone only tracks the local branches of the bundled working copy as origin branches
+		err = repo.git().FetchRemoteBranches(directory, bundlePath, OriginRemote)
+		if err != nil {
+			return fmt.Errorf("in %s, fetching remote branches from %s failed: %v", directory, bundlePath, err)
+		}
+		err = repo.git().SetRemoteURL(directory, OriginRemote, repo.SSHURLToRepo)
+		if err != nil {
+			return fmt.Errorf("in %s, setting origin to %s failed: %v", directory, repo.SSHURLToRepo, err)
+		}
+		return repo.setUpClone(directory)
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := repo.RunPostClone(); err != nil {
+		return true, fmt.Errorf("post-clone setup failed: %v", err)
+	}
+	if _, _, err := repo.SyncWorktrees(); err != nil {
+		return true, fmt.Errorf("post-clone setup failed: %v", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,35 @@
+package gitrepo
+
+import (
+	"gcm/internal/gitremote"
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestRestoreFromBundle_KeepsRemoteBranches(t *testing.T) {
+	backend := NewFakeBackend()
+	backend.AddRemote("git@example.com:team/app", FakeRemote{Branches: []string{"main", "release/1.0"}, Commits: 2})
+	project := gitremote.GitRemoteProjectConfig{Name: "app", FullPath: "team/app"}
+	repo := CreateFromGitRemoteConfig(project, "example.com", t.TempDir(), "", backend)
+	if err := repo.Clone(); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := path.Join(t.TempDir(), "app.bundle")
+	if bundled, err := repo.CreateBundle(bundlePath); err != nil || !bundled {
+		t.Fatalf("expected a bundle, got %v, %v", bundled, err)
+	}
+
+	restored := CreateFromGitRemoteConfig(project, "example.com", t.TempDir(), "", backend)
+	if done, err := restored.RestoreFromBundle(bundlePath); err != nil || !done {
+		t.Fatalf("expected the working copy to be restored, got %v, %v", done, err)
+	}
+
+	branches, err := backend.RemoteBranches(restored.WorkingCopyPath(), OriginRemote)
+	if err != nil || !slices.Equal(branches, []string{"main", "release/1.0"}) {
+		t.Errorf("expected the branch not checked out to be tracked after restoring, got %v, %v", branches, err)
+	}
+	if origin, _ := backend.RemoteURL(restored.WorkingCopyPath(), OriginRemote); origin != repo.SSHURLToRepo {
+		t.Errorf("expected origin %s, got %s", repo.SSHURLToRepo, origin)
+	}
+}
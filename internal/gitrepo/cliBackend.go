@@ -0,0 +1,297 @@
+package gitrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gcm/internal/sh"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// CliBackend implements Backend by running the git executable found on PATH
+type CliBackend struct {
+	ctx context.Context // Running git processes are killed when done
+}
+
+func NewCliBackend() *CliBackend {
+	return NewCliBackendWithContext(context.Background())
+}
+
+// NewCliBackendWithContext creates a backend whose git processes are killed when ctx is done
+func NewCliBackendWithContext(ctx context.Context) *CliBackend {
+	return &CliBackend{ctx: ctx}
+}
+
+func (b *CliBackend) git(directory string, args ...string) (string, error) {
+	return sh.ExecuteCommandContext(b.ctx, sh.DirectoryPath(directory), "git", args...)
+}
+
+func (b *CliBackend) Clone(url string, directory string, flags []string) error {
+	args := append([]string{"clone"}, flags...)
+	_, err := b.git(directory, append(args, "--", url, ".")...)
+	return err
+}
+
+func (b *CliBackend) Fetch(directory string, options FetchOptions) error {
+	args := []string{"fetch"}
+	if options.Prune {
+		args = append(args, "--prune")
+	}
+	if options.All {
+		args = append(args, "--all")
+	}
+	if options.Tags {
+		args = append(args, "--tags")
+	}
+	_, err := b.git(directory, args...)
+	return err
+}
+
+func (b *CliBackend) Status(directory string) (Status, error) {
+	out, err := b.git(directory, "status", "--porcelain=v2", "--branch")
+	if err != nil {
+		return Status{}, err
+	}
+	return parsePorcelainStatus(out)
+}
+
+// parsePorcelainStatus reads the output of git status --porcelain=v2 --branch
+func parsePorcelainStatus(out string) (Status, error) {
+	var status Status
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "# branch.head "):
+			head := strings.TrimPrefix(line, "# branch.head ")
+			if head != "(detached)" {
+				status.Branch = head
+			}
+		case strings.HasPrefix(line, "# branch.ab "):
+			var err error
+			fields := strings.Fields(strings.TrimPrefix(line, "# branch.ab "))
+			if len(fields) != 2 {
+				return status, fmt.Errorf("unexpected branch.ab line in git status: %q", line)
+			}
+			if status.Ahead, err = strconv.Atoi(strings.TrimPrefix(fields[0], "+")); err != nil {
+				return status, err
+			}
+			if status.Behind, err = strconv.Atoi(strings.TrimPrefix(fields[1], "-")); err != nil {
+				return status, err
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			status.Dirty = true
+		}
+	}
+	return status, nil
+}
+
+func (b *CliBackend) RemoteURL(directory string, remote string) (string, error) {
+	return b.git(directory, "remote", "get-url", remote)
+}
+
+func (b *CliBackend) SetRemoteURL(directory string, remote string, url string) error {
+	_, err := b.git(directory, "remote", "set-url", remote, url)
+	return err
+}
+
+// configValue reads a single git config value, reporting false when it is not set
+func (b *CliBackend) configValue(directory string, key string) (string, bool, error) {
+	out, err := b.git(directory, "config", "--get", key)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return out, true, nil
+}
+
+func (b *CliBackend) Completeness(directory string) (Completeness, error) {
+	var completeness Completeness
+	shallow, err := b.git(directory, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return completeness, err
+	}
+	completeness.Shallow = shallow == "true"
+
+	completeness.PartialFilter, _, err = b.configValue(directory, "remote.origin.partialclonefilter")
+	if err != nil {
+		return completeness, err
+	}
+
+	refspecs, err := b.git(directory, "config", "--get-all", "remote.origin.fetch")
+	if err != nil {
+		return completeness, err
+	}
+	completeness.SingleBranch = !strings.Contains(refspecs, "refs/heads/*")
+	return completeness, nil
+}
+
+func (b *CliBackend) MakeComplete(directory string) error {
+	completeness, err := b.Completeness(directory)
+	if err != nil || completeness.IsComplete() {
+		return err
+	}
+	if completeness.SingleBranch {
+		if _, err := b.git(directory, "remote", "set-branches", OriginRemote, "*"); err != nil {
+			return err
+		}
+	}
+	fetchArgs := []string{"fetch", OriginRemote}
+	if completeness.Shallow {
+		fetchArgs = append(fetchArgs, "--unshallow")
+	}
+	if completeness.PartialFilter != "" {
+		// Without the filter in config, refetch gets every object like a full clone would
+		if _, err := b.git(directory, "config", "--unset", "remote.origin.partialclonefilter"); err != nil {
+			return err
+		}
+		fetchArgs = append(fetchArgs, "--refetch")
+	}
+	if _, err := b.git(directory, fetchArgs...); err != nil {
+		return err
+	}
+	if completeness.PartialFilter != "" {
+		_, err = b.git(directory, "config", "--unset", "remote.origin.promisor")
+	}
+	return err
+}
+
+func (b *CliBackend) SparseCheckout(directory string) ([]string, error) {
+	enabled, _, err := b.configValue(directory, "core.sparseCheckout")
+	if err != nil || enabled != "true" {
+		return nil, err
+	}
+	out, err := b.git(directory, "sparse-checkout", "list")
+	if err != nil {
+		return nil, err
+	}
+	if out == "" {
+		return []string{}, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+func (b *CliBackend) SetSparseCheckout(directory string, directories []string) error {
+	if len(directories) == 0 {
+		_, err := b.git(directory, "sparse-checkout", "disable")
+		return err
+	}
+	_, err := b.git(directory, append([]string{"sparse-checkout", "set", "--cone"}, directories...)...)
+	return err
+}
+
+func (b *CliBackend) LfsPull(directory string) error {
+	_, err := b.git(directory, "lfs", "pull")
+	return err
+}
+
+func (b *CliBackend) SetConfig(directory string, key string, value string) error {
+	_, err := b.git(directory, "config", key, value)
+	return err
+}
+
+func (b *CliBackend) Fsck(directory string) error {
+	_, err := b.git(directory, "fsck", "--connectivity-only", "--no-progress")
+	return err
+}
+
+func (b *CliBackend) HasCommits(directory string) (bool, error) {
+	_, err := b.git(directory, "rev-parse", "--verify", "--quiet", "HEAD")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *CliBackend) RemoteHasCommits(directory string, remote string) (bool, error) {
+	out, err := b.git(directory, "ls-remote", "--heads", remote)
+	if err != nil {
+		return false, err
+	}
+	return out != "", nil
+}
+
+func (b *CliBackend) RemoteBranches(directory string, remote string) ([]string, error) {
+	out, err := b.git(directory, "for-each-ref", "--format=%(refname:lstrip=3)", "refs/remotes/"+remote)
+	if err != nil {
+		return nil, err
+	}
+	branches := []string{}
+	for _, branch := range strings.Split(out, "\n") {
+		if branch != "" && branch != "HEAD" {
+			branches = append(branches, branch)
+		}
+	}
+	return branches, nil
+}
+
+func (b *CliBackend) FetchRemoteBranches(directory string, source string, remote string) error {
+	refspec := fmt.Sprintf("+refs/remotes/%s/*:refs/remotes/%s/*", remote, remote)
+	_, err := b.git(directory, "fetch", "--tags", source, refspec)
+	return err
+}
+
+func (b *CliBackend) Worktrees(directory string) ([]string, error) {
+	out, err := b.git(directory, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	return parseWorktreeList(out), nil
+}
+
+// parseWorktreeList reads the linked worktree paths from the output of git worktree list --porcelain,
+// where the main working copy always comes first
+func parseWorktreeList(out string) []string {
+	worktrees := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "worktree ") {
+			worktrees = append(worktrees, strings.TrimPrefix(line, "worktree "))
+		}
+	}
+	if len(worktrees) == 0 {
+		return worktrees
+	}
+	return worktrees[1:]
+}
+
+func (b *CliBackend) AddWorktree(directory string, worktreePath string, branch string) error {
+	_, err := b.git(directory, "worktree", "add", "--", worktreePath, branch)
+	return err
+}
+
+func (b *CliBackend) RemoveWorktree(directory string, worktreePath string) error {
+	_, err := b.git(directory, "worktree", "remove", "--", worktreePath)
+	return err
+}
+
+func (b *CliBackend) UpdateMirror(directory string, name string, url string) error {
+	if _, err := os.Stat(path.Join(directory, "HEAD")); os.IsNotExist(err) {
+		if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+			return err
+		}
+		if _, err := b.git(directory, "init", "--bare", "--quiet"); err != nil {
+			return err
+		}
+	}
+	refspec := fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", name)
+	_, err := b.git(directory, "fetch", "--prune", "--no-tags", "--quiet", "--", url, refspec)
+	return err
+}
+
+func (b *CliBackend) CreateBundle(directory string, bundlePath string) error {
+	_, err := b.git(directory, "bundle", "create", "--quiet", bundlePath, "--all")
+	return err
+}
+
+func (b *CliBackend) RunCommand(directory string, command string) error {
+	_, err := sh.ExecuteCommandContext(b.ctx, sh.DirectoryPath(directory), "sh", "-c", command)
+	return err
+}
@@ -0,0 +1,83 @@
+package gitrepo
+
+import (
+	"context"
+	"gcm/internal/gitremote"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParsePorcelainStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Status
+	}{
+		{
+			name:     "Clean and up to date",
+			input:    "# branch.oid 1234\n# branch.head main\n# branch.upstream origin/main\n# branch.ab +0 -0",
+			expected: Status{Branch: "main"},
+		},
+		{
+			name:     "Dirty, ahead and behind",
+			input:    "# branch.head feature\n# branch.ab +2 -3\n1 .M N... 100644 100644 100644 12 34 file.go\n? new.go",
+			expected: Status{Branch: "feature", Dirty: true, Ahead: 2, Behind: 3},
+		},
+		{
+			name:     "Detached head",
+			input:    "# branch.oid 1234\n# branch.head (detached)",
+			expected: Status{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := parsePorcelainStatus(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if status != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, status)
+			}
+		})
+	}
+}
+
+func TestParseWorktreeList(t *testing.T) {
+	out := "worktree /src/app\nHEAD 1234\nbranch refs/heads/main\n\n" +
+		"worktree /src/app@release-1.0\nHEAD 5678\nbranch refs/heads/release/1.0\n"
+	worktrees := parseWorktreeList(out)
+	if !slices.Equal(worktrees, []string{"/src/app@release-1.0"}) {
+		t.Errorf("expected only the linked worktree, got %v", worktrees)
+	}
+}
+
+func TestRunPostClone_StopsLongRunningCommandsWhenKilled(t *testing.T) {
+	ctx, kill := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer kill()
+	repo := CreateFromGitRemoteConfig(
+		gitremote.GitRemoteProjectConfig{
+			Name:     "app",
+			FullPath: "team/app",
+			CloneConfig: gitremote.CloneConfig{
+				PostClone: gitremote.PostCloneConfig{Commands: []string{"sleep 30; echo done"}},
+			},
+		},
+		"example.com", t.TempDir(), "", NewCliBackendWithContext(ctx),
+	)
+	if err := os.MkdirAll(repo.WorkingCopyPath(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	err := repo.RunPostClone()
+
+	if err == nil {
+		t.Errorf("expected the killed post-clone command to fail")
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("expected the post-clone command to be stopped when killed, ran for %v", elapsed)
+	}
+}
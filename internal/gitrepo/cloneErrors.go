@@ -0,0 +1,62 @@
+package gitrepo
+
+import (
+	"strings"
+)
+
+// sshConnectionFailures are what git reports when the host refuses or drops SSH connections, typically because too
+// many were opened at the same time
+var sshConnectionFailures = []string{
+	"kex_exchange_identification",
+	"ssh_exchange_identification",
+	"Connection reset by peer",
+	"Connection closed by remote host",
+}
+
+// transientCloneFailures are network failures that may well not happen again when cloning once more
+var transientCloneFailures = []string{
+	"The remote end hung up unexpectedly",
+	"the remote end hung up unexpectedly",
+	"early EOF",
+	"Connection timed out",
+	"Operation timed out",
+	"RPC failed",
+	"Could not resolve hostname",
+	"Temporary failure in name resolution",
+}
+
+// permanentCloneFailures will happen again however often the clone is tried, even when the connection broke as well
+var permanentCloneFailures = []string{
+	"Permission denied",
+	"Repository not found",
+	"could not be found",
+	"does not appear to be a git repository",
+	"Host key verification failed",
+}
+
+// IsSSHConnectionFailure tells whether a clone failed because the SSH connection was refused or dropped
+func IsSSHConnectionFailure(err error) bool {
+	return err != nil && containsAny(err.Error(), sshConnectionFailures)
+}
+
+// IsTransientCloneError tells whether a failed clone is worth trying again: the network or the host failed, not the
+// repository or the permissions to it
+func IsTransientCloneError(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := err.Error()
+	if containsAny(message, permanentCloneFailures) {
+		return false
+	}
+	return IsSSHConnectionFailure(err) || containsAny(message, transientCloneFailures)
+}
+
+func containsAny(message string, fragments []string) bool {
+	for _, fragment := range fragments {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
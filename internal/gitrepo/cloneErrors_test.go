@@ -0,0 +1,45 @@
+package gitrepo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsSSHConnectionFailure(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{errKexReset, true},
+		{errors.New("exit status 128: Connection closed by remote host"), true},
+		{errors.New("exit status 128: ERROR: The project you were looking for could not be found"), false},
+	}
+	for _, test := range tests {
+		if actual := IsSSHConnectionFailure(test.err); actual != test.expected {
+			t.Errorf("IsSSHConnectionFailure(%v) = %v, expected %v", test.err, actual, test.expected)
+		}
+	}
+}
+
+func TestIsTransientCloneError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{errKexReset, true},
+		{errors.New("exit status 128: fetch-pack: unexpected disconnect\nfatal: early EOF"), true},
+		{errors.New("exit status 128: fatal: the remote end hung up unexpectedly"), true},
+		{errors.New("exit status 128: git@example.com: Permission denied (publickey).\n" +
+			"fatal: Could not read from remote repository."), false},
+		{errors.New("exit status 128: ERROR: The project you were looking for could not be found or you don't have " +
+			"permission to view it.\nfatal: the remote end hung up unexpectedly"), false},
+		{errors.New("exit status 128: fatal: destination path '.' already exists"), false},
+	}
+	for _, test := range tests {
+		if actual := IsTransientCloneError(test.err); actual != test.expected {
+			t.Errorf("IsTransientCloneError(%v) = %v, expected %v", test.err, actual, test.expected)
+		}
+	}
+}
@@ -1,37 +1,221 @@
 package gitrepo
 
 import (
+	"context"
 	"fmt"
+	"gcm/internal/channel"
 	"gcm/internal/counter"
 	"gcm/internal/log"
+	"github.com/samber/lo"
+	"math/rand/v2"
+	"path"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
-func CloneRepositories(repositories <-chan GitRepo, cloneCounter *counter.Counter, errorChannel chan error) {
-	cloneWaitGroup := sync.WaitGroup{}
-	for {
-		receivedRepo, ok := <-repositories
-		if !ok {
-			break
+// ClonePool Limits how many clones run at the same time across all hosts
+type ClonePool struct {
+	slots chan struct{}
+}
+
+func NewClonePool(maxConcurrentClones int) *ClonePool {
+	return &ClonePool{slots: make(chan struct{}, max(maxConcurrentClones, 1))}
+}
+
+func (pool *ClonePool) size() int {
+	return cap(pool.slots)
+}
+
+// acquire waits for a free slot, it returns ctx.Err() once ctx is done. Every acquired slot needs a release.
+func (pool *ClonePool) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case pool.slots <- struct{}{}:
+		return nil
+	}
+}
+
+func (pool *ClonePool) release() {
+	<-pool.slots
+}
+
+// CloneCounters What CloneRepositories counts. Queued is counted up when repositories are scheduled for cloning,
+// see channel.Counted, and down when their clone starts.
+type CloneCounters struct {
+	Queued          *counter.Counter
+	Cloning         *counter.Counter
+	Cloned          *counter.Counter
+	CloneErrors     *counter.Counter
+	PostCloneErrors *counter.Counter
+	Retries         *counter.Counter
+	Report          *RunReport // Outcome of every clone, may be nil
+}
+
+// CloneRetries How often a clone failing with a transient error, see IsTransientCloneError, is tried again
+type CloneRetries struct {
+	Max     int           // Retries after the first attempt, 0 for none
+	Backoff time.Duration // Wait before the first retry, doubled for every further one
+}
+
+// cloneAttempt A repository to clone with what its earlier attempts left behind
+type cloneAttempt struct {
+	repo     GitRepo
+	attempts int           // Attempts made so far
+	backoff  time.Duration // Wait before the next retry
+	wait     time.Duration // Wait before this attempt, the backoff of the one before with jitter
+	started  time.Time     // Start of the first attempt
+	lastErr  error         // Error of the latest attempt
+}
+
+// CloneRepositories clones repositories with maxConcurrentClones workers, each taking a slot of pool while cloning.
+// maxConcurrentClones 0 leaves the limit to the pool. When ctx is done no more clones start, running clones finish.
+// Clones failing with a transient error are tried again as retries allows. While waiting to be retried a repository
+// holds neither a worker nor a slot, and every retry takes a token of limiter like first attempts do before they come
+// in. The outcome of every attempt is reported to adaptiveRate. limiter and adaptiveRate may be nil.
+func CloneRepositories(
+	ctx context.Context,
+	repositories <-chan GitRepo,
+	pool *ClonePool,
+	maxConcurrentClones int,
+	counters CloneCounters,
+	limiter *channel.Limiter,
+	adaptiveRate *AdaptiveCloneRate,
+	retries CloneRetries,
+	errorChannel chan error,
+) {
+	workers := pool.size()
+	if maxConcurrentClones > 0 {
+		workers = min(maxConcurrentClones, workers)
+	}
+	// Retries are sent back to the workers, attempts closes once every repository has its outcome
+	attempts := make(chan cloneAttempt)
+	unfinished := sync.WaitGroup{}
+	go func() {
+		for receivedRepo := range repositories {
+			unfinished.Add(1)
+			attempts <- cloneAttempt{repo: receivedRepo, backoff: retries.Backoff}
 		}
+		unfinished.Wait()
+		close(attempts)
+	}()
+	cloneWaitGroup := sync.WaitGroup{}
+	for range workers {
 		cloneWaitGroup.Add(1)
 		go func() {
 			defer cloneWaitGroup.Done()
-			err := receivedRepo.Clone()
-			if err != nil {
-				errorChannel <- fmt.Errorf("failed to clone project %s: %v", receivedRepo.GetName(), err)
-				return
+			for attempt := range attempts {
+				next, retry := cloneOnce(ctx, attempt, pool, counters, adaptiveRate, retries, errorChannel)
+				if !retry {
+					unfinished.Done()
+					continue
+				}
+				counters.Retries.Add(1)
+				go func() {
+					select {
+					case <-ctx.Done():
+					case <-time.After(next.wait):
+					}
+					// Fails only once ctx is done, the retry then reports the error of the attempt before
+					if limiter != nil {
+						_ = limiter.Wait(ctx)
+					}
+					attempts <- next
+				}()
 			}
-			cloneCounter.Add(1)
 		}()
 	}
 	cloneWaitGroup.Wait()
 }
 
+// cloneOnce makes one attempt to clone the repository in a slot of pool. It returns the attempt to make next and true
+// when the clone should be tried again, otherwise the outcome is reported.
+func cloneOnce(
+	ctx context.Context,
+	attempt cloneAttempt,
+	pool *ClonePool,
+	counters CloneCounters,
+	adaptiveRate *AdaptiveCloneRate,
+	retries CloneRetries,
+	errorChannel chan error,
+) (cloneAttempt, bool) {
+	repo := attempt.repo
+	if err := pool.acquire(ctx); err != nil {
+		if attempt.attempts == 0 {
+			// Once ctx is done queued repositories are drained without cloning so the producers can finish
+			counters.Queued.Add(-1)
+			counters.Report.Record(repo, OutcomeFailed, 0, err)
+		} else {
+			cloneFailed(repo, time.Since(attempt.started), attempt.lastErr, counters, errorChannel)
+		}
+		return attempt, false
+	}
+	defer pool.release()
+	if attempt.attempts == 0 {
+		counters.Queued.Add(-1)
+		attempt.started = time.Now()
+	}
+	counters.Cloning.Add(1)
+	defer counters.Cloning.Add(-1)
+
+	started := time.Now()
+	err := repo.Clone()
+	adaptiveRate.CloneFinished(started, err)
+	attempt.attempts++
+	if err != nil {
+		if attempt.attempts <= retries.Max && IsTransientCloneError(err) && ctx.Err() == nil {
+			next := attempt
+			next.wait = withJitter(attempt.backoff)
+			next.backoff *= 2
+			logger.Log.Warnf("Cloning %s failed, trying again in %v: %v", repo.GetName(), next.wait.Round(time.Millisecond), err)
+			next.lastErr = err
+			return next, true
+		}
+		cloneFailed(repo, time.Since(attempt.started), err, counters, errorChannel)
+		return attempt, false
+	}
+	counters.Cloned.Add(1)
+	err = repo.RunPostClone()
+	if err == nil {
+		_, _, err = repo.SyncWorktrees()
+	}
+	if err != nil {
+		counters.PostCloneErrors.Add(1)
+		counters.Report.Record(repo, OutcomeFailed, time.Since(attempt.started),
+			fmt.Errorf("post-clone setup failed: %v", err))
+		errorChannel <- fmt.Errorf("post-clone setup of project %s failed: %v", repo.GetName(), err)
+		return attempt, false
+	}
+	counters.Report.Record(repo, OutcomeCloned, time.Since(attempt.started), nil)
+	return attempt, false
+}
+
+// withJitter adds up to half of backoff at random, so repositories failing together are not retried together
+func withJitter(backoff time.Duration) time.Duration {
+	if backoff < 2 {
+		return backoff
+	}
+	return backoff + rand.N(backoff/2)
+}
+
+func cloneFailed(repo GitRepo, duration time.Duration, err error, counters CloneCounters, errorChannel chan error) {
+	counters.CloneErrors.Add(1)
+	counters.Report.Record(repo, OutcomeFailed, duration, err)
+	errorChannel <- fmt.Errorf("failed to clone project %s: %v", repo.GetName(), err)
+}
+
+// FilterCloneNeeded passes on the repositories that need cloning. The outcome for the others is recorded to report,
+// which may be nil.
 func FilterCloneNeeded(
 	repositories <-chan GitRepo,
 	archivedCounter *counter.Counter,
 	clonedCounter *counter.Counter,
+	report *RunReport,
 	errorChan chan error,
 ) chan GitRepo {
 	gitCloneChannel := make(chan GitRepo, 20)
@@ -43,26 +227,20 @@ func FilterCloneNeeded(
 				logger.Log.Tracef("%s \n", "Clone errorChan close, wait for last clone to finish, then breaking")
 				break
 			}
-			if receivedRepo.IsArchived() && receivedRepo.GetCloneOptions().CloneArchived() {
-				archivedCounter.Add(1)
-			}
-
-			needsCloning, err := receivedRepo.CheckNeedsCloning()
-			if err != nil {
-				errorChan <- fmt.Errorf("error checking if project needs cloning %s: %v", receivedRepo.GetName(), err)
-				continue
-			}
-
-			cloned, err := receivedRepo.IsCloned()
+			skipReason, err := cloneSkipReason(receivedRepo, archivedCounter, clonedCounter)
 			if err != nil {
-				errorChan <- fmt.Errorf("error checking clone status %s: %v", receivedRepo.GetName(), err)
+				report.Record(receivedRepo, OutcomeFailed, 0, err)
+				errorChan <- err
 				continue
 			}
-			if cloned || needsCloning {
-				clonedCounter.Add(1)
+			switch skipReason {
+			case SkipAlreadyCloned:
+				report.Record(receivedRepo, OutcomeAlreadyCloned, 0, nil)
+			case SkipArchived:
+				report.Record(receivedRepo, OutcomeSkippedArchived, 0, nil)
 			}
 
-			if needsCloning {
+			if skipReason == "" {
 				checkWaitGroup.Add(1)
 				go func() {
 					defer checkWaitGroup.Done()
@@ -78,3 +256,140 @@ func FilterCloneNeeded(
 	}()
 	return gitCloneChannel
 }
+
+// workingCopyUpdateWorkers Working copies updated at the same time before cloning, each update runs a few local git
+// commands
+const workingCopyUpdateWorkers = 8
+
+// ApplySparseCheckouts passes all repositories on, after re-applying sparse-checkout configuration to those already cloned
+func ApplySparseCheckouts(
+	repositories <-chan GitRepo,
+	updatedCounter *counter.Counter,
+	errorChan chan error,
+) <-chan GitRepo {
+	return channel.Parallel(repositories, workingCopyUpdateWorkers, func(receivedRepo GitRepo) (GitRepo, bool) {
+		// Errors checking clone status are reported when filtering
+		cloned, err := receivedRepo.IsCloned()
+		if err == nil && cloned {
+			updated, err := receivedRepo.ApplySparseCheckout()
+			if err != nil {
+				errorChan <- fmt.Errorf("error applying sparse checkout to %s: %v", receivedRepo.GetName(), err)
+			} else if updated {
+				updatedCounter.Add(1)
+			}
+		}
+		return receivedRepo, true
+	}, 20)
+}
+
+// SyncWorktrees passes all repositories on, after adding and removing worktrees of those already cloned
+func SyncWorktrees(
+	repositories <-chan GitRepo,
+	addedCounter *counter.Counter,
+	removedCounter *counter.Counter,
+	errorChan chan error,
+) <-chan GitRepo {
+	return channel.Parallel(repositories, workingCopyUpdateWorkers, func(receivedRepo GitRepo) (GitRepo, bool) {
+		// Errors checking clone status are reported when filtering
+		cloned, err := receivedRepo.IsCloned()
+		if err == nil && cloned {
+			added, removed, err := receivedRepo.SyncWorktrees()
+			addedCounter.Add(added)
+			removedCounter.Add(removed)
+			if err != nil {
+				errorChan <- fmt.Errorf("error updating worktrees of %s: %v", receivedRepo.GetName(), err)
+			}
+		}
+		return receivedRepo, true
+	}, 20)
+}
+
+// SyncArchivedMarkers passes all repositories on, after updating archived markers of those already cloned.
+// changed is called for every working copy that was archived or unarchived since the last run. Failures are recorded
+// to report, which may be nil.
+func SyncArchivedMarkers(
+	repositories <-chan GitRepo,
+	changed func(GitRepo),
+	report *RunReport,
+	errorChan chan error,
+) chan GitRepo {
+	outChannel := make(chan GitRepo, 20)
+	go func() {
+		for receivedRepo := range repositories {
+			// Errors checking clone status are reported when filtering
+			cloned, err := receivedRepo.IsCloned()
+			if err == nil && cloned {
+				updated, err := receivedRepo.SyncArchivedMarker()
+				if err != nil {
+					report.Record(receivedRepo, OutcomeFailed, 0, fmt.Errorf("updating the archived marker failed: %v", err))
+					errorChan <- fmt.Errorf("error updating archived marker of %s: %v", receivedRepo.GetName(), err)
+				} else if updated {
+					changed(receivedRepo)
+				}
+			}
+			outChannel <- receivedRepo
+		}
+		close(outChannel)
+	}()
+	return outChannel
+}
+
+// DetectPathCollisions waits for all repositories, then passes on those with a working copy path of their own.
+// Repositories the layout places at the same path, or inside each other, are reported, recorded as failed to report,
+// which may be nil, and left out. The same repository configured twice is passed on once.
+func DetectPathCollisions(repositories <-chan GitRepo, report *RunReport, errorChan chan error) chan GitRepo {
+	outChannel := make(chan GitRepo, 20)
+	go func() {
+		byPath := make(map[string][]GitRepo)
+		for receivedRepo := range repositories {
+			if err := receivedRepo.CheckWorkingCopyPath(); err != nil {
+				report.Record(receivedRepo, OutcomeFailed, 0, err)
+				errorChan <- fmt.Errorf("cannot place working copy of %s: %v", receivedRepo.GetName(), err)
+				continue
+			}
+			workingCopyPath := receivedRepo.WorkingCopyPath()
+			duplicate := lo.ContainsBy(byPath[workingCopyPath], func(repo GitRepo) bool {
+				return repo.GetSSHURLToRepo() == receivedRepo.GetSSHURLToRepo()
+			})
+			if duplicate {
+				logger.Log.Debugf("%s is configured more than once", receivedRepo.GetSSHURLToRepo())
+				continue
+			}
+			byPath[workingCopyPath] = append(byPath[workingCopyPath], receivedRepo)
+		}
+
+		paths := lo.Keys(byPath)
+		slices.Sort(paths)
+		colliding := make(map[string]bool)
+		for _, workingCopyPath := range paths {
+			if len(byPath[workingCopyPath]) > 1 {
+				colliding[workingCopyPath] = true
+			}
+			for parent := path.Dir(workingCopyPath); parent != path.Dir(parent); parent = path.Dir(parent) {
+				if _, nested := byPath[parent]; nested {
+					colliding[parent] = true
+					colliding[workingCopyPath] = true
+				}
+			}
+		}
+
+		for _, workingCopyPath := range paths {
+			if !colliding[workingCopyPath] {
+				outChannel <- byPath[workingCopyPath][0]
+				continue
+			}
+			collision := fmt.Errorf("working copy path %s collides with another project", workingCopyPath)
+			for _, repo := range byPath[workingCopyPath] {
+				report.Record(repo, OutcomeFailed, 0, collision)
+			}
+			names := lo.Map(byPath[workingCopyPath], func(repo GitRepo, _ int) string { return repo.GetName() })
+			errorChan <- fmt.Errorf(
+				"working copy path %s collides with another project, skipping %s",
+				workingCopyPath,
+				strings.Join(names, ", "),
+			)
+		}
+		close(outChannel)
+	}()
+	return outChannel
+}
@@ -1,188 +1,501 @@
 package gitrepo
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"gcm/internal/channel"
 	"gcm/internal/counter"
+	"gcm/internal/gitremote"
+	"github.com/samber/lo"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-type MockGitRepo struct {
-	name                 string
-	archived             bool
-	cloneOptions         CloneOptions
-	needsCloning         bool
-	isCloned             bool
-	cloneError           error
-	isClonedError        error
-	checkCloneErr        error
-	markerHasBeenWritten bool
+// skipArchivedOptions leaves archived projects out unless they are cloned already
+type skipArchivedOptions struct {
+	RemoteCloneOptions
 }
 
-func (m *MockGitRepo) WriteArchivedMarker(_ string) error {
-	m.markerHasBeenWritten = true
-	return nil
+func (skipArchivedOptions) CloneArchived() bool {
+	return false
 }
 
-func (m *MockGitRepo) GetName() string {
-	return m.name
+// fakeRepository is team/name on host, cloneable from backend with remote
+func fakeRepository(
+	backend *FakeBackend,
+	cloneDirectory string,
+	host string,
+	name string,
+	remote FakeRemote,
+) *GitRepository {
+	repo := CreateFromGitRemoteConfig(
+		gitremote.GitRemoteProjectConfig{Name: name, FullPath: "team/" + name}, host, cloneDirectory, "", backend,
+	)
+	backend.AddRemote(repo.SSHURLToRepo, remote)
+	return repo
 }
 
-func (m *MockGitRepo) IsArchived() bool {
-	return m.archived
+func repoChannelOf(repos ...GitRepo) chan GitRepo {
+	repoChannel := make(chan GitRepo, len(repos))
+	for _, repo := range repos {
+		repoChannel <- repo
+	}
+	close(repoChannel)
+	return repoChannel
 }
 
-func (m *MockGitRepo) GetCloneOptions() CloneOptions {
-	return m.cloneOptions
-}
+func TestFilterCloneNeeded(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	remote := FakeRemote{Branches: []string{"main"}, Commits: 1}
+	newRepo := fakeRepository(backend, cloneDirectory, "example.com", "new", remote)
+	clonedRepo := fakeRepository(backend, cloneDirectory, "example.com", "cloned", remote)
+	archivedClonedRepo := fakeRepository(backend, cloneDirectory, "example.com", "archivedCloned", remote)
+	archivedRepo := fakeRepository(backend, cloneDirectory, "example.com", "archived", remote)
+	for _, repo := range []*GitRepository{clonedRepo, archivedClonedRepo} {
+		if err := repo.Clone(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archivedClonedRepo.Archived = true
+	archivedRepo.Archived = true
+	archivedRepo.CloneOptions = skipArchivedOptions{archivedRepo.CloneOptions.(RemoteCloneOptions)}
+	archivedCounter := counter.NewCounter()
+	clonedCounter := counter.NewCounter()
+	errorChannel := make(chan error, 10)
 
-func (m *MockGitRepo) CheckNeedsCloning() (bool, error) {
-	return m.needsCloning, m.checkCloneErr
-}
+	filteredChannel := FilterCloneNeeded(
+		repoChannelOf(newRepo, clonedRepo, archivedClonedRepo, archivedRepo),
+		archivedCounter, clonedCounter, nil, errorChannel,
+	)
 
-func (m *MockGitRepo) IsCloned() (bool, error) {
-	return m.isCloned, m.isClonedError
+	var filtered []string
+	for repo := range filteredChannel {
+		filtered = append(filtered, repo.GetName())
+	}
+	if !slices.Equal(filtered, []string{"new"}) {
+		t.Errorf("expected only new to be cloned, got %v", filtered)
+	}
+	if archivedCounter.Count() != 1 {
+		t.Errorf("expected 1 archived repo, got %d", archivedCounter.Count())
+	}
+	if clonedCounter.Count() != 3 {
+		t.Errorf("expected 3 cloned repos, got %d", clonedCounter.Count())
+	}
+	if len(errorChannel) != 0 {
+		t.Errorf("expected no errors, got %d", len(errorChannel))
+	}
 }
 
-func (m *MockGitRepo) Clone() error {
-	return m.cloneError
-}
+func TestFilterCloneNeeded_ErrorHandling(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	repo := fakeRepository(backend, cloneDirectory, "example.com", "app", FakeRemote{Branches: []string{"main"}})
+	// A file where the working copy directory should be cannot be checked for a .git directory
+	if err := os.MkdirAll(path.Join(cloneDirectory, "team"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(repo.WorkingCopyPath(), []byte("not a directory"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report := NewRunReport()
+	errorChannel := make(chan error, 10)
 
-type MockCloneOptions struct {
-	cloneArchived bool
-}
+	filteredChannel := FilterCloneNeeded(
+		repoChannelOf(repo), counter.NewCounter(), counter.NewCounter(), report, errorChannel,
+	)
 
-func (m MockCloneOptions) CloneArchived() bool {
-	return m.cloneArchived
+	for repo := range filteredChannel {
+		t.Errorf("expected %s not to be cloned", repo.GetName())
+	}
+	if len(errorChannel) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(errorChannel))
+	}
+	if err := <-errorChannel; !strings.HasPrefix(err.Error(), "error checking clone status app: ") {
+		t.Errorf("expected an error checking the clone status of app, got %v", err)
+	}
+	entries := report.Entries()
+	if len(entries) != 1 || entries[0].Outcome != OutcomeFailed {
+		t.Errorf("expected app to be recorded as failed, got %+v", entries)
+	}
 }
 
-func (m MockCloneOptions) CloneRootDirectory() string {
-	return "faking/it/somewhere"
+func TestSyncArchivedMarkers(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	remote := FakeRemote{Branches: []string{"main"}, Commits: 1}
+	archivedRepo := fakeRepository(backend, cloneDirectory, "example.com", "archived", remote)
+	activeRepo := fakeRepository(backend, cloneDirectory, "example.com", "active", remote)
+	notClonedRepo := fakeRepository(backend, cloneDirectory, "example.com", "notCloned", remote)
+	for _, repo := range []*GitRepository{archivedRepo, activeRepo} {
+		if err := repo.Clone(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, repo := range []*GitRepository{archivedRepo, activeRepo, notClonedRepo} {
+		repo.ArchivedKnown = true
+	}
+	archivedRepo.Archived = true
+	notClonedRepo.Archived = true
+	var changed []string
+
+	out := SyncArchivedMarkers(
+		repoChannelOf(archivedRepo, activeRepo, notClonedRepo),
+		func(repo GitRepo) { changed = append(changed, repo.GetName()) },
+		nil,
+		make(chan error, 10),
+	)
+
+	var passed []string
+	for repo := range out {
+		passed = append(passed, repo.GetName())
+	}
+	if !slices.Equal(passed, []string{"archived", "active", "notCloned"}) {
+		t.Errorf("expected all repositories to be passed on, got %v", passed)
+	}
+	if !slices.Equal(changed, []string{"archived"}) {
+		t.Errorf("expected only the marker of archived to change, got %v", changed)
+	}
+	if _, err := os.Stat(path.Join(archivedRepo.WorkingCopyPath(), ArchivedMarkerFileName)); err != nil {
+		t.Errorf("expected archived marker: %v", err)
+	}
+	if _, err := os.Stat(notClonedRepo.WorkingCopyPath()); !os.IsNotExist(err) {
+		t.Errorf("expected no working copy to be created for notCloned")
+	}
 }
 
-func TestFilterCloneNeeded(t *testing.T) {
-	archivedCounter := counter.NewCounter()
-	clonedCounter := counter.NewCounter()
+func TestCloneRepositories(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	backend.AddRemote("git@example.com:team/app", FakeRemote{Branches: []string{"main"}})
+	backend.AddRemote("git@example.com:team/tools", FakeRemote{Branches: []string{"main"}})
+	counters := newCloneCounters()
 	errorChannel := make(chan error, 10)
-	defer close(errorChannel)
 
 	repos := []GitRepo{
-		&MockGitRepo{
-			name:         "repo1",
-			archived:     false,
-			needsCloning: true,
-			isCloned:     false,
-			cloneOptions: MockCloneOptions{},
-		},
-		&MockGitRepo{
-			name:         "repo2",
-			archived:     true,
-			needsCloning: false,
-			isCloned:     true,
-			cloneOptions: MockCloneOptions{},
-		},
-		&MockGitRepo{
-			name:         "cloneArchivedRepo",
-			archived:     true,
-			needsCloning: false,
-			isCloned:     true,
-			cloneOptions: MockCloneOptions{
-				cloneArchived: true,
+		CreateFromGitRemoteConfig(
+			gitremote.GitRemoteProjectConfig{
+				Name:     "app",
+				FullPath: "team/app",
+				CloneConfig: gitremote.CloneConfig{
+					PostClone: gitremote.PostCloneConfig{
+						GitConfig: map[string]string{"user.email": "me@example.com"},
+						Commands:  []string{"touch bootstrapped"},
+					},
+				},
 			},
-		},
-		&MockGitRepo{
-			name:         "repo3",
-			archived:     false,
-			needsCloning: false,
-			isCloned:     false,
-			cloneOptions: MockCloneOptions{},
-		},
+			"example.com", cloneDirectory, "", backend,
+		),
+		CreateFromGitRemoteConfig(
+			gitremote.GitRemoteProjectConfig{Name: "gone", FullPath: "team/gone"}, "example.com", cloneDirectory, "", backend,
+		),
+		CreateFromGitRemoteConfig(
+			gitremote.GitRemoteProjectConfig{
+				Name:     "tools",
+				FullPath: "team/tools",
+				CloneConfig: gitremote.CloneConfig{
+					PostClone: gitremote.PostCloneConfig{Commands: []string{"exit 3"}},
+				},
+			},
+			"example.com", cloneDirectory, "", backend,
+		),
 	}
-
 	repoChannel := make(chan GitRepo, len(repos))
 	for _, repo := range repos {
 		repoChannel <- repo
 	}
 	close(repoChannel)
 
-	filteredChannel := FilterCloneNeeded(repoChannel, archivedCounter, clonedCounter, errorChannel)
+	CloneRepositories(
+		context.Background(), repoChannel, NewClonePool(4), 2, counters, nil, nil, CloneRetries{}, errorChannel,
+	)
+	close(errorChannel)
 
-	var filteredRepos []GitRepo
-	for repo := range filteredChannel {
-		filteredRepos = append(filteredRepos, repo)
+	if counters.Cloned.Count() != 2 {
+		t.Errorf("expected 2 repos to be cloned, got %d", counters.Cloned.Count())
+	}
+	if counters.CloneErrors.Count() != 1 {
+		t.Errorf("expected 1 clone error, got %d", counters.CloneErrors.Count())
+	}
+	if counters.PostCloneErrors.Count() != 1 {
+		t.Errorf("expected 1 post-clone error, got %d", counters.PostCloneErrors.Count())
+	}
+	if counters.Cloning.Count() != 0 {
+		t.Errorf("expected no clone running when done, got %d", counters.Cloning.Count())
+	}
+	if cloned, _ := repos[1].IsCloned(); cloned {
+		t.Errorf("expected gone not to be cloned")
+	}
+	appPath := path.Join(cloneDirectory, "team/app")
+	status, err := backend.Status(appPath)
+	if err != nil || status.Branch != "main" {
+		t.Errorf("expected app to be on main, got %+v, %v", status, err)
+	}
+	if email, _ := backend.ConfigValue(appPath, "user.email"); email != "me@example.com" {
+		t.Errorf("expected post-clone git config user.email to be set, got %q", email)
+	}
+	if _, err := os.Stat(path.Join(appPath, "bootstrapped")); err != nil {
+		t.Errorf("expected post-clone command to run in working copy: %v", err)
 	}
+	var errors []error
+	for err := range errorChannel {
+		errors = append(errors, err)
+	}
+	if len(errors) != 2 {
+		t.Errorf("expected 2 errors, got %v", errors)
+	}
+}
 
-	if len(filteredRepos) != 1 {
-		t.Errorf("expected 1 repo to be cloned, got %d", len(filteredRepos))
+func newCloneCounters() CloneCounters {
+	return CloneCounters{
+		Queued:          counter.NewCounter(),
+		Cloning:         counter.NewCounter(),
+		Cloned:          counter.NewCounter(),
+		CloneErrors:     counter.NewCounter(),
+		PostCloneErrors: counter.NewCounter(),
+		Retries:         counter.NewCounter(),
 	}
+}
 
-	if filteredRepos[0].GetName() != "repo1" {
-		t.Errorf("expected repo1 to be cloned, got %s", filteredRepos[0].GetName())
+// concurrency Tracks the most clones running at the same time
+type concurrency struct {
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (c *concurrency) enter() {
+	running := c.running.Add(1)
+	for peak := c.peak.Load(); running > peak && !c.peak.CompareAndSwap(peak, running); peak = c.peak.Load() {
 	}
+}
 
-	if archivedCounter.Count() != 1 {
-		t.Errorf("expected 1 archived repo, got %d", archivedCounter.Count())
+func (c *concurrency) leave() {
+	c.running.Add(-1)
+}
+
+// slowClones makes clones of backend take a while, tracking those running from host, all hosts when host is empty
+func slowClones(backend *FakeBackend, trackers map[string]*concurrency) {
+	backend.CloneHook = func(url string) {
+		for host, tracker := range trackers {
+			if host == "" || strings.HasPrefix(url, "git@"+host+":") {
+				tracker.enter()
+				defer tracker.leave()
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCloneRepositories_LimitsConcurrentClones(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	pool := NewClonePool(3)
+	var all, hostA, hostB concurrency
+	slowClones(backend, map[string]*concurrency{"": &all, "a.example.com": &hostA, "b.example.com": &hostB})
+	hostChannel := func(host string) chan GitRepo {
+		var repos []GitRepo
+		for i := range 10 {
+			repos = append(repos, fakeRepository(
+				backend, cloneDirectory, host, fmt.Sprintf("%s-repo%d", host, i), FakeRemote{Branches: []string{"main"}},
+			))
+		}
+		return repoChannelOf(repos...)
 	}
 
-	if clonedCounter.Count() != 3 {
-		t.Errorf("expected 3 cloned repos, got %d", clonedCounter.Count())
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(2)
+	go func() {
+		defer waitGroup.Done()
+		CloneRepositories(
+			context.Background(), hostChannel("a.example.com"), pool, 1, newCloneCounters(), nil, nil, CloneRetries{},
+			make(chan error, 10),
+		)
+	}()
+	go func() {
+		defer waitGroup.Done()
+		CloneRepositories(
+			context.Background(), hostChannel("b.example.com"), pool, 0, newCloneCounters(), nil, nil, CloneRetries{},
+			make(chan error, 10),
+		)
+	}()
+	waitGroup.Wait()
+
+	if peak := all.peak.Load(); peak > 3 {
+		t.Errorf("expected at most 3 clones at the same time across hosts, got %d", peak)
+	}
+	if peak := hostA.peak.Load(); peak != 1 {
+		t.Errorf("expected 1 clone at a time for the host limited to 1, got %d", peak)
 	}
 }
 
-func TestFilterCloneNeeded_ErrorHandling(t *testing.T) {
-	archivedCounter := counter.NewCounter()
-	clonedCounter := counter.NewCounter()
+func TestCloneRepositories_StartsNoClonesOnceCancelled(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	var all concurrency
+	slowClones(backend, map[string]*concurrency{"": &all})
+	var repos []GitRepo
+	for i := range 5 {
+		repos = append(repos, fakeRepository(
+			backend, cloneDirectory, "example.com", fmt.Sprintf("repo%d", i), FakeRemote{Branches: []string{"main"}},
+		))
+	}
+	repoChannel := repoChannelOf(repos...)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	counters := newCloneCounters()
+	counters.Report = NewRunReport()
+
+	CloneRepositories(ctx, repoChannel, NewClonePool(2), 0, counters, nil, nil, CloneRetries{}, make(chan error, 10))
+
+	if peak := all.peak.Load(); peak != 0 {
+		t.Errorf("expected no clones after cancellation, got %d", peak)
+	}
+	if cloned := counters.Cloned.Count(); cloned != 0 {
+		t.Errorf("expected 0 cloned, got %d", cloned)
+	}
+	failed := lo.CountBy(counters.Report.Entries(), func(entry RunReportEntry) bool {
+		return entry.Outcome == OutcomeFailed
+	})
+	if failed != 5 {
+		t.Errorf("expected the 5 repositories not cloned to be recorded as failed, got %d", failed)
+	}
+}
+
+// cloneFlaky clones a repository failing its first clones with failures, counting the clone attempts. Retries take
+// tokens of limiter, which may be nil.
+func cloneFlaky(
+	t *testing.T,
+	failures []error,
+	retries CloneRetries,
+	limiter *channel.Limiter,
+) (int, CloneCounters, []error) {
+	backend := NewFakeBackend()
+	var attempts atomic.Int32
+	backend.CloneHook = func(string) {
+		attempts.Add(1)
+	}
+	repo := fakeRepository(
+		backend, t.TempDir(), "example.com", "flaky", FakeRemote{Branches: []string{"main"}, CloneErrors: failures},
+	)
+	counters := newCloneCounters()
 	errorChannel := make(chan error, 10)
-	defer close(errorChannel)
+	CloneRepositories(
+		context.Background(), repoChannelOf(repo), NewClonePool(1), 0, counters, limiter, nil, retries, errorChannel,
+	)
+	close(errorChannel)
+	var errs []error
+	for err := range errorChannel {
+		errs = append(errs, err)
+	}
+	return int(attempts.Load()), counters, errs
+}
 
-	repos := []GitRepo{
-		&MockGitRepo{
-			name:          "errorCheckingCloning",
-			archived:      false,
-			needsCloning:  false,
-			isCloned:      false,
-			isClonedError: fmt.Errorf("Fake error checking for cloned status"),
-			cloneOptions:  MockCloneOptions{},
-		},
-		&MockGitRepo{
-			name:          "errorCheckingNeedsCloning",
-			archived:      false,
-			needsCloning:  false,
-			isCloned:      false,
-			checkCloneErr: fmt.Errorf("Fake error checking if needs cloning"),
-			cloneOptions:  MockCloneOptions{},
-		},
+func TestCloneRepositories_RetriesTransientErrors(t *testing.T) {
+	attempts, counters, errs := cloneFlaky(
+		t,
+		[]error{errKexReset, errors.New("fatal: early EOF")},
+		CloneRetries{Max: 2, Backoff: time.Millisecond},
+		nil,
+	)
+
+	if attempts != 3 || counters.Cloned.Count() != 1 || counters.Retries.Count() != 2 || len(errs) != 0 {
+		t.Errorf(
+			"expected a clone after 2 retries, got %d attempts, %d cloned, %d retries, errors %v",
+			attempts, counters.Cloned.Count(), counters.Retries.Count(), errs,
+		)
 	}
+}
 
-	repoChannel := make(chan GitRepo, len(repos))
-	for _, repo := range repos {
-		repoChannel <- repo
+func TestCloneRepositories_ReportsErrorWhenRetriesAreUsedUp(t *testing.T) {
+	attempts, counters, errs := cloneFlaky(
+		t,
+		[]error{errKexReset, errKexReset, errKexReset},
+		CloneRetries{Max: 1, Backoff: time.Millisecond},
+		nil,
+	)
+
+	if attempts != 2 || counters.CloneErrors.Count() != 1 || len(errs) != 1 {
+		t.Errorf("expected 2 attempts and 1 error, got %d attempts and errors %v", attempts, errs)
 	}
-	close(repoChannel)
+}
 
-	filteredChannel := FilterCloneNeeded(repoChannel, archivedCounter, clonedCounter, errorChannel)
+func TestCloneRepositories_DoesNotRetryPermanentErrors(t *testing.T) {
+	attempts, _, errs := cloneFlaky(
+		t,
+		[]error{errors.New("git@example.com: Permission denied (publickey).")},
+		CloneRetries{Max: 3, Backoff: time.Millisecond},
+		nil,
+	)
 
-	var filteredRepos []GitRepo
-	for repo := range filteredChannel {
-		filteredRepos = append(filteredRepos, repo)
+	if attempts != 1 || len(errs) != 1 {
+		t.Errorf("expected 1 attempt and 1 error, got %d attempts and errors %v", attempts, errs)
 	}
+}
 
-	if len(errorChannel) != 2 {
-		t.Errorf("expected 2 errors, got %d", len(errorChannel))
+func TestCloneRepositories_RetriesTakeATokenOfTheLimiter(t *testing.T) {
+	limiter := channel.NewLimiter(4, 1)
+	// The first attempt took the token of the full bucket before it was passed in
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
 	}
+	started := time.Now()
 
-	expectedErrors := []string{
-		"error checking clone status errorCheckingCloning: Fake error checking for cloned status",
-		"error checking if project needs cloning errorCheckingNeedsCloning: Fake error checking if needs cloning",
+	attempts, counters, _ := cloneFlaky(
+		t,
+		[]error{errKexReset},
+		CloneRetries{Max: 1, Backoff: time.Millisecond},
+		limiter,
+	)
+
+	if attempts != 2 || counters.Cloned.Count() != 1 {
+		t.Errorf("expected a clone after 1 retry, got %d attempts and %d cloned", attempts, counters.Cloned.Count())
+	}
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Errorf("expected the retry to wait for a token at 4 per second, it started after %v", elapsed)
 	}
+}
 
-	for _, expectedError := range expectedErrors {
-		select {
-		case err := <-errorChannel:
-			if err.Error() != expectedError {
-				t.Errorf("expected error %s, got %s", expectedError, err.Error())
-			}
-		default:
-			t.Errorf("expected error %s, but no error found", expectedError)
+func TestWithJitter(t *testing.T) {
+	for range 100 {
+		if wait := withJitter(time.Second); wait < time.Second || wait >= 1500*time.Millisecond {
+			t.Fatalf("expected a wait of at least the backoff and less than half more, got %v", wait)
 		}
 	}
 }
+
+func TestCloneRepositories_ClonesOthersWhileWaitingToRetry(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	var cloned []string
+	var mutex sync.Mutex
+	backend.CloneHook = func(url string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		cloned = append(cloned, strings.TrimPrefix(url, "git@example.com:team/"))
+	}
+	repoChannel := repoChannelOf(
+		fakeRepository(
+			backend, cloneDirectory, "example.com", "flaky",
+			FakeRemote{Branches: []string{"main"}, CloneErrors: []error{errKexReset}},
+		),
+		fakeRepository(backend, cloneDirectory, "example.com", "repo1", FakeRemote{Branches: []string{"main"}}),
+		fakeRepository(backend, cloneDirectory, "example.com", "repo2", FakeRemote{Branches: []string{"main"}}),
+	)
+
+	CloneRepositories(
+		context.Background(), repoChannel, NewClonePool(1), 0, newCloneCounters(), nil, nil,
+		CloneRetries{Max: 1, Backoff: 50 * time.Millisecond}, make(chan error, 10),
+	)
+
+	expected := []string{"flaky", "repo1", "repo2", "flaky"}
+	if !slices.Equal(cloned, expected) {
+		t.Errorf("expected clone attempts %v while the flaky repository waits to retry, got %v", expected, cloned)
+	}
+}
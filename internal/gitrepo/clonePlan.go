@@ -0,0 +1,78 @@
+package gitrepo
+
+import (
+	"cmp"
+	"fmt"
+	"gcm/internal/counter"
+	"slices"
+)
+
+// Reasons why a repository is not cloned
+const (
+	SkipAlreadyCloned = "already cloned"
+	SkipArchived      = "archived, cloneArchived is off"
+)
+
+// ClonePlanEntry What cloning would do with a repository, SkipReason is empty when it would be cloned
+type ClonePlanEntry struct {
+	Repo       GitRepo
+	SkipReason string
+}
+
+func (entry ClonePlanEntry) WouldClone() bool {
+	return entry.SkipReason == ""
+}
+
+// PlanClones decides like FilterCloneNeeded which repositories need cloning, and counts them the same way, but clones
+// nothing and tells why the others are skipped. The plan is ordered by working copy path.
+func PlanClones(
+	repositories <-chan GitRepo,
+	archivedCounter *counter.Counter,
+	clonedCounter *counter.Counter,
+	errorChan chan error,
+) []ClonePlanEntry {
+	var plan []ClonePlanEntry
+	for receivedRepo := range repositories {
+		skipReason, err := cloneSkipReason(receivedRepo, archivedCounter, clonedCounter)
+		if err != nil {
+			errorChan <- err
+			continue
+		}
+		plan = append(plan, ClonePlanEntry{Repo: receivedRepo, SkipReason: skipReason})
+	}
+	SortClonePlan(plan)
+	return plan
+}
+
+// SortClonePlan orders a plan by working copy path
+func SortClonePlan(plan []ClonePlanEntry) {
+	slices.SortFunc(plan, func(a, b ClonePlanEntry) int {
+		return cmp.Compare(a.Repo.WorkingCopyPath(), b.Repo.WorkingCopyPath())
+	})
+}
+
+// cloneSkipReason decides whether repo needs cloning, for cloning and for plans alike. It returns why repo is not
+// cloned, empty when it needs cloning, and counts repo to the archived projects and to those cloned or to be cloned.
+func cloneSkipReason(repo GitRepo, archivedCounter *counter.Counter, clonedCounter *counter.Counter) (string, error) {
+	if repo.IsArchived() && repo.GetCloneOptions().CloneArchived() {
+		archivedCounter.Add(1)
+	}
+	cloned, err := repo.IsCloned()
+	if err != nil {
+		return "", fmt.Errorf("error checking clone status %s: %v", repo.GetName(), err)
+	}
+	if cloned {
+		clonedCounter.Add(1)
+		return SkipAlreadyCloned, nil
+	}
+	needsCloning, err := repo.CheckNeedsCloning()
+	if err != nil {
+		return "", fmt.Errorf("error checking if project needs cloning %s: %v", repo.GetName(), err)
+	}
+	if !needsCloning {
+		// Archived projects are the only ones left out when not cloned yet
+		return SkipArchived, nil
+	}
+	clonedCounter.Add(1)
+	return "", nil
+}
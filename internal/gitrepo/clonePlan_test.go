@@ -0,0 +1,63 @@
+package gitrepo
+
+import (
+	"gcm/internal/counter"
+	"slices"
+	"testing"
+)
+
+// planRepositories are a project to clone, one already cloned and an archived one left out
+func planRepositories(t *testing.T) []GitRepo {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	remote := FakeRemote{Branches: []string{"main"}, Commits: 1}
+	newRepo := fakeRepository(backend, cloneDirectory, "example.com", "new", remote)
+	clonedRepo := fakeRepository(backend, cloneDirectory, "example.com", "cloned", remote)
+	if err := clonedRepo.Clone(); err != nil {
+		t.Fatal(err)
+	}
+	archivedRepo := fakeRepository(backend, cloneDirectory, "example.com", "archived", remote)
+	archivedRepo.Archived = true
+	archivedRepo.CloneOptions = skipArchivedOptions{archivedRepo.CloneOptions.(RemoteCloneOptions)}
+	return []GitRepo{newRepo, clonedRepo, archivedRepo}
+}
+
+func TestPlanClones(t *testing.T) {
+	clonedCounter := counter.NewCounter()
+
+	plan := PlanClones(repoChannelOf(planRepositories(t)...), counter.NewCounter(), clonedCounter, make(chan error, 10))
+
+	var actual []string
+	for _, entry := range plan {
+		actual = append(actual, entry.Repo.GetName()+": "+entry.SkipReason)
+	}
+	expected := []string{"archived: " + SkipArchived, "cloned: " + SkipAlreadyCloned, "new: "}
+	if !slices.Equal(actual, expected) {
+		t.Errorf("expected plan %q, got %q", expected, actual)
+	}
+	if count := clonedCounter.Count(); count != 2 {
+		t.Errorf("expected 2 repositories counted as cloned or to clone, got %d", count)
+	}
+}
+
+func TestPlanClones_AgreesWithFilterCloneNeeded(t *testing.T) {
+	repos := planRepositories(t)
+
+	plan := PlanClones(repoChannelOf(repos...), counter.NewCounter(), counter.NewCounter(), make(chan error, 10))
+	filtered := FilterCloneNeeded(
+		repoChannelOf(repos...), counter.NewCounter(), counter.NewCounter(), nil, make(chan error, 10),
+	)
+
+	var planned, cloned []string
+	for _, entry := range plan {
+		if entry.WouldClone() {
+			planned = append(planned, entry.Repo.GetName())
+		}
+	}
+	for repo := range filtered {
+		cloned = append(cloned, repo.GetName())
+	}
+	if !slices.Equal(planned, cloned) || !slices.Equal(cloned, []string{"new"}) {
+		t.Errorf("expected the plan and cloning to pick [new], got plan %v and cloning %v", planned, cloned)
+	}
+}
@@ -0,0 +1,78 @@
+package gitrepo
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+)
+
+// DiskUsage Bytes a working copy takes on disk, by what they are used for
+type DiskUsage struct {
+	WorkingTree int64 `json:"workingTreeBytes"` // Checked out files, everything outside .git
+	Objects     int64 `json:"objectsBytes"`     // .git/objects
+	Lfs         int64 `json:"lfsBytes"`         // Git LFS content in .git/lfs
+}
+
+func (u DiskUsage) Total() int64 {
+	return u.WorkingTree + u.Objects + u.Lfs
+}
+
+func (u *DiskUsage) Add(other DiskUsage) {
+	u.WorkingTree += other.WorkingTree
+	u.Objects += other.Objects
+	u.Lfs += other.Lfs
+}
+
+// DiskUsage measures the working copy by adding up the sizes of its files
+func (repo *GitRepository) DiskUsage() (DiskUsage, error) {
+	var usage DiskUsage
+	projectPath := repo.WorkingCopyPath()
+	gitDir := path.Join(projectPath, ".git")
+	err := filepath.WalkDir(projectPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == gitDir {
+			return fs.SkipDir
+		}
+		usage.WorkingTree += fileSize(entry)
+		return nil
+	})
+	if err != nil {
+		return usage, err
+	}
+	if usage.Objects, err = directorySize(path.Join(gitDir, "objects")); err != nil {
+		return usage, err
+	}
+	usage.Lfs, err = directorySize(path.Join(gitDir, "lfs"))
+	return usage, err
+}
+
+// directorySize adds up the sizes of all files below directory, 0 when it does not exist
+func directorySize(directory string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(directory, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if filePath == directory && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		size += fileSize(entry)
+		return nil
+	})
+	return size, err
+}
+
+func fileSize(entry fs.DirEntry) int64 {
+	if !entry.Type().IsRegular() {
+		return 0
+	}
+	info, err := entry.Info()
+	if err != nil {
+		// Removed while walking
+		return 0
+	}
+	return info.Size()
+}
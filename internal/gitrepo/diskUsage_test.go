@@ -0,0 +1,39 @@
+package gitrepo
+
+import (
+	"gcm/internal/gitremote"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestDiskUsage(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	repo := CreateFromGitRemoteConfig(
+		gitremote.GitRemoteProjectConfig{Name: "app", FullPath: "team/app"}, "example.com", cloneDirectory, "", nil,
+	)
+	files := map[string]int{
+		"README.md":                        10,
+		"src/main.go":                      20,
+		".git/config":                      5,
+		".git/objects/pack/pack-1.pack":    300,
+		".git/lfs/objects/ab/cd/abcdef012": 4000,
+	}
+	for name, size := range files {
+		filePath := path.Join(cloneDirectory, "team", "app", name)
+		if err := os.MkdirAll(path.Dir(filePath), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage, err := repo.DiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != (DiskUsage{WorkingTree: 30, Objects: 300, Lfs: 4000}) {
+		t.Errorf("unexpected disk usage %+v", usage)
+	}
+}
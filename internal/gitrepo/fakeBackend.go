@@ -0,0 +1,529 @@
+package gitrepo
+
+import (
+	"fmt"
+	"gcm/internal/sh"
+	"github.com/samber/lo"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const fakeCloneIdFile = "gcm-fake-clone"
+
+// FakeRemote is a remote repository known to a FakeBackend
+type FakeRemote struct {
+	Branches   []string // The first branch is checked out on clone
+	Commits    int      // Commits on the default branch, raise to make working copies fall behind
+	CloneError error    // Returned by Clone and UpdateMirror instead of cloning or fetching
+	// Returned by the first clones in order, the clones after them succeed
+	CloneErrors []error
+	// Remote-tracking branches of origin in a bundle, fetched from it with FetchRemoteBranches
+	originBranches []string
+}
+
+type fakeClone struct {
+	remotes  map[string]string
+	branch   string
+	tracking []string // Remote-tracking branches of origin
+	fetched  int      // Remote commits known after the latest fetch
+	merged   int      // Remote commits merged into the working copy
+	fetches  int
+	flags    []string
+	complete Completeness
+	sparse   []string
+	lfsPulls int
+	config   map[string]string
+	corrupt  bool
+	// Linked worktree paths with their branch
+	worktrees map[string]string
+}
+
+/*
+FakeBackend is an in-memory Backend for testing commands without git on the machine.
+Cloning creates the working copy directory with a .git directory containing only an id,
+all other repository state lives in memory so working copies can still be moved around on disk.
+*/
+type FakeBackend struct {
+	mutex   sync.Mutex
+	remotes map[string]*FakeRemote
+	clones  map[string]*fakeClone
+	nextId  int
+	mirrors map[string][]string // Names fetched into each mirror directory
+	// CloneHook runs at the start of every clone, outside the lock so tests can slow clones down or watch them
+	CloneHook func(url string)
+}
+
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		remotes: make(map[string]*FakeRemote),
+		clones:  make(map[string]*fakeClone),
+		mirrors: make(map[string][]string),
+	}
+}
+
+// AddRemote makes url cloneable
+func (b *FakeBackend) AddRemote(url string, remote FakeRemote) *FakeRemote {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.remotes[url] = &remote
+	return &remote
+}
+
+// FetchCount reports how many times the working copy in directory has been fetched
+func (b *FakeBackend) FetchCount(directory string) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return 0, err
+	}
+	return clone.fetches, nil
+}
+
+// LfsPullCount reports how many times Git LFS content has been pulled into the working copy in directory
+func (b *FakeBackend) LfsPullCount(directory string) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return 0, err
+	}
+	return clone.lfsPulls, nil
+}
+
+// ConfigValue reads a value set with SetConfig in the working copy in directory
+func (b *FakeBackend) ConfigValue(directory string, key string) (string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return "", err
+	}
+	return clone.config[key], nil
+}
+
+// Corrupt makes Fsck fail for the working copy in directory
+func (b *FakeBackend) Corrupt(directory string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	clone.corrupt = true
+	return nil
+}
+
+// MirrorNames reports the names fetched into the mirror in directory with UpdateMirror
+func (b *FakeBackend) MirrorNames(directory string) []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return slices.Clone(b.mirrors[directory])
+}
+
+func (b *FakeBackend) lookup(directory string) (*fakeClone, error) {
+	id, err := os.ReadFile(path.Join(directory, ".git", fakeCloneIdFile))
+	if err != nil {
+		return nil, fmt.Errorf("fatal: not a git repository: %s", directory)
+	}
+	clone, ok := b.clones[string(id)]
+	if !ok {
+		return nil, fmt.Errorf("fatal: unknown fake repository in %s", directory)
+	}
+	return clone, nil
+}
+
+func (b *FakeBackend) remoteOf(clone *fakeClone, remoteName string) (*FakeRemote, error) {
+	remote, ok := b.remotes[clone.remotes[remoteName]]
+	if !ok {
+		return nil, fmt.Errorf("fatal: '%s' does not appear to be a git repository", remoteName)
+	}
+	return remote, nil
+}
+
+// CloneFlags reports the flags the working copy in directory was cloned with
+func (b *FakeBackend) CloneFlags(directory string) ([]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(clone.flags), nil
+}
+
+func (b *FakeBackend) Clone(url string, directory string, flags []string) error {
+	if b.CloneHook != nil {
+		b.CloneHook(url)
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	remote, ok := b.remotes[url]
+	if !ok {
+		return fmt.Errorf("fatal: repository '%s' not found", url)
+	}
+	if remote.CloneError != nil {
+		return remote.CloneError
+	}
+	if len(remote.CloneErrors) > 0 {
+		err := remote.CloneErrors[0]
+		remote.CloneErrors = remote.CloneErrors[1:]
+		return err
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("fatal: destination path '%s' already exists and is not an empty directory", directory)
+	}
+	if err := os.Mkdir(path.Join(directory, ".git"), os.ModePerm); err != nil {
+		return err
+	}
+	b.nextId++
+	id := fmt.Sprintf("%d", b.nextId)
+	if err := os.WriteFile(path.Join(directory, ".git", fakeCloneIdFile), []byte(id), 0644); err != nil {
+		return err
+	}
+	clone := &fakeClone{
+		remotes:   map[string]string{OriginRemote: url},
+		config:    make(map[string]string),
+		worktrees: make(map[string]string),
+		fetched:   remote.Commits,
+		merged:    remote.Commits,
+		flags:     slices.Clone(flags),
+	}
+	for _, flag := range flags {
+		switch {
+		case strings.HasPrefix(flag, "--depth"):
+			clone.complete.Shallow = true
+		case strings.HasPrefix(flag, "--filter="):
+			clone.complete.PartialFilter = strings.TrimPrefix(flag, "--filter=")
+		case flag == "--single-branch":
+			clone.complete.SingleBranch = true
+		case flag == "--sparse":
+			clone.sparse = []string{}
+		}
+	}
+	if len(remote.Branches) > 0 {
+		clone.branch = remote.Branches[0]
+		clone.tracking = slices.Clone(remote.Branches)
+		if clone.complete.SingleBranch {
+			clone.tracking = []string{clone.branch}
+		}
+	}
+	b.clones[id] = clone
+	return nil
+}
+
+func (b *FakeBackend) Fetch(directory string, options FetchOptions) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	remote, err := b.remoteOf(clone, OriginRemote)
+	if err != nil {
+		return err
+	}
+	clone.fetched = remote.Commits
+	clone.fetches++
+	if !clone.complete.SingleBranch {
+		clone.tracking = slices.Clone(remote.Branches)
+	}
+	return nil
+}
+
+func (b *FakeBackend) Status(directory string) (Status, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return Status{}, err
+	}
+	return Status{
+		Branch: clone.branch,
+		Behind: clone.fetched - clone.merged,
+	}, nil
+}
+
+func (b *FakeBackend) RemoteURL(directory string, remote string) (string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return "", err
+	}
+	url, ok := clone.remotes[remote]
+	if !ok {
+		return "", fmt.Errorf("error: No such remote '%s'", remote)
+	}
+	return url, nil
+}
+
+func (b *FakeBackend) SetRemoteURL(directory string, remote string, url string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	if _, ok := clone.remotes[remote]; !ok {
+		return fmt.Errorf("error: No such remote '%s'", remote)
+	}
+	clone.remotes[remote] = strings.TrimSpace(url)
+	return nil
+}
+
+func (b *FakeBackend) Completeness(directory string) (Completeness, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return Completeness{}, err
+	}
+	return clone.complete, nil
+}
+
+func (b *FakeBackend) MakeComplete(directory string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	remote, err := b.remoteOf(clone, OriginRemote)
+	if err != nil {
+		return err
+	}
+	clone.complete = Completeness{}
+	clone.tracking = slices.Clone(remote.Branches)
+	return nil
+}
+
+func (b *FakeBackend) SparseCheckout(directory string) ([]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(clone.sparse), nil
+}
+
+func (b *FakeBackend) SetSparseCheckout(directory string, directories []string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	if len(directories) == 0 {
+		clone.sparse = nil
+	} else {
+		clone.sparse = slices.Clone(directories)
+	}
+	return nil
+}
+
+func (b *FakeBackend) LfsPull(directory string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	clone.lfsPulls++
+	return nil
+}
+
+func (b *FakeBackend) SetConfig(directory string, key string, value string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	clone.config[key] = value
+	return nil
+}
+
+func (b *FakeBackend) Fsck(directory string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	if clone.corrupt {
+		return fmt.Errorf("broken link from commit to tree")
+	}
+	return nil
+}
+
+func (b *FakeBackend) HasCommits(directory string) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return false, err
+	}
+	return clone.merged > 0, nil
+}
+
+func (b *FakeBackend) RemoteHasCommits(directory string, remoteName string) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return false, err
+	}
+	remote, err := b.remoteOf(clone, remoteName)
+	if err != nil {
+		return false, err
+	}
+	return remote.Commits > 0, nil
+}
+
+func (b *FakeBackend) RemoteBranches(directory string, remoteName string) ([]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := b.remoteOf(clone, remoteName); err != nil {
+		return nil, err
+	}
+	return slices.Clone(clone.tracking), nil
+}
+
+func (b *FakeBackend) FetchRemoteBranches(directory string, source string, remoteName string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	remote, ok := b.remotes[source]
+	if !ok {
+		return fmt.Errorf("fatal: '%s' does not appear to be a git repository", source)
+	}
+	if remoteName != OriginRemote {
+		return fmt.Errorf("fatal: fake repositories only track %s", OriginRemote)
+	}
+	for _, branch := range remote.originBranches {
+		if !slices.Contains(clone.tracking, branch) {
+			clone.tracking = append(clone.tracking, branch)
+		}
+	}
+	return nil
+}
+
+func (b *FakeBackend) Worktrees(directory string) ([]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return nil, err
+	}
+	worktrees := make([]string, 0, len(clone.worktrees))
+	for worktreePath := range clone.worktrees {
+		worktrees = append(worktrees, worktreePath)
+	}
+	slices.Sort(worktrees)
+	return worktrees, nil
+}
+
+func (b *FakeBackend) AddWorktree(directory string, worktreePath string, branch string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	for _, checkedOut := range append(lo.Values(clone.worktrees), clone.branch) {
+		if checkedOut == branch {
+			return fmt.Errorf("fatal: '%s' is already checked out", branch)
+		}
+	}
+	if _, err := os.Stat(worktreePath); err == nil {
+		return fmt.Errorf("fatal: '%s' already exists", worktreePath)
+	}
+	if err := os.MkdirAll(worktreePath, os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(worktreePath, ".git"), []byte("gitdir: "+directory), 0644); err != nil {
+		return err
+	}
+	clone.worktrees[worktreePath] = branch
+	return nil
+}
+
+func (b *FakeBackend) RemoveWorktree(directory string, worktreePath string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	if _, ok := clone.worktrees[worktreePath]; !ok {
+		return fmt.Errorf("fatal: '%s' is not a working tree", worktreePath)
+	}
+	delete(clone.worktrees, worktreePath)
+	return os.RemoveAll(worktreePath)
+}
+
+func (b *FakeBackend) UpdateMirror(directory string, name string, url string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	remote, ok := b.remotes[url]
+	if !ok {
+		return fmt.Errorf("fatal: repository '%s' not found", url)
+	}
+	if remote.CloneError != nil {
+		return remote.CloneError
+	}
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return err
+	}
+	if !slices.Contains(b.mirrors[directory], name) {
+		b.mirrors[directory] = append(b.mirrors[directory], name)
+	}
+	return nil
+}
+
+// CreateBundle writes a bundle file and makes it cloneable like a remote. Cloning it checks out the branch of the
+// working copy in directory and tracks its local branches only, FetchRemoteBranches adds the remote-tracking ones.
+func (b *FakeBackend) CreateBundle(directory string, bundlePath string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	clone, err := b.lookup(directory)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(bundlePath, []byte("# fake git bundle\n"), 0644); err != nil {
+		return err
+	}
+	heads := []string{clone.branch}
+	for _, worktreePath := range slices.Sorted(maps.Keys(clone.worktrees)) {
+		heads = append(heads, clone.worktrees[worktreePath])
+	}
+	b.remotes[bundlePath] = &FakeRemote{
+		Branches:       heads,
+		Commits:        clone.merged,
+		originBranches: slices.Clone(clone.tracking),
+	}
+	return nil
+}
+
+// RunCommand runs the shell command for real, post-clone commands in tests create files or fail on purpose
+func (b *FakeBackend) RunCommand(directory string, command string) error {
+	_, err := sh.ExecuteCommand(sh.DirectoryPath(directory), "sh", "-c", command)
+	return err
+}
@@ -4,24 +4,56 @@ import (
 	"fmt"
 	"gcm/internal/gitremote"
 	. "gcm/internal/log"
-	"gcm/internal/sh"
 	"github.com/sirupsen/logrus"
 	"os"
 	"path"
+	"path/filepath"
+	"slices"
 )
 
 type GitRepository struct {
 	Name              string
 	SSHURLToRepo      string
 	PathWithNamespace string
+	GroupPath         string // Full path of the provider group the project is in, empty for projects configured directly
 	Archived          bool
+	ArchivedKnown     bool // Archived comes from the provider, not known for projects configured directly
 	CloneOptions      CloneOptions
+	Backend           Backend // git implementation, the git command line when nil
+	ReferenceCache    string  // Directory with bare mirrors to clone from, no reference cache when empty
+	ForkOf            string  // URL of the project this one is a fork of, forks share its reference mirror
+	ProjectID         int     // ID of the project at the provider, 0 for projects configured directly
+	HostName          string
 }
 
 func (repo *GitRepository) GetName() string {
 	return repo.Name
 }
 
+func (repo *GitRepository) GetPathWithNamespace() string {
+	return repo.PathWithNamespace
+}
+
+func (repo *GitRepository) GetGroupPath() string {
+	return repo.GroupPath
+}
+
+func (repo *GitRepository) GetProjectID() int {
+	return repo.ProjectID
+}
+
+func (repo *GitRepository) GetHostName() string {
+	return repo.HostName
+}
+
+func (repo *GitRepository) GetReferenceCache() string {
+	return repo.ReferenceCache
+}
+
+func (repo *GitRepository) GetForkOf() string {
+	return repo.ForkOf
+}
+
 func (repo *GitRepository) IsArchived() bool {
 	return repo.Archived
 }
@@ -30,35 +62,262 @@ func (repo *GitRepository) GetCloneOptions() CloneOptions {
 	return repo.CloneOptions
 }
 
+func (repo *GitRepository) git() Backend {
+	if repo.Backend == nil {
+		return NewCliBackend()
+	}
+	return repo.Backend
+}
+
+// Clone clones into a temporary directory next to the working copy path and moves it into place when done,
+// so a failed or interrupted clone never leaves a directory that looks like a working copy.
 func (repo *GitRepository) Clone() error {
 	needsCloning, checkErr := repo.CheckNeedsCloning()
 	if !needsCloning {
 		return checkErr
 	}
 
-	projectPath := repo.getWorkingCopyPath(repo.CloneOptions.CloneRootDirectory())
+	projectPath := repo.WorkingCopyPath()
 	Log.Infof("Cloning %s to %s", repo.Name, projectPath)
-	err := os.MkdirAll(projectPath, os.ModePerm)
+	return cloneAtomically(projectPath, repo.cloneInto)
+}
+
+// cloneAtomically runs clone on a temporary directory next to projectPath and moves the result into place on success
+func cloneAtomically(projectPath string, clone func(directory string) error) error {
+	err := os.MkdirAll(path.Dir(projectPath), os.ModePerm)
 	if err != nil {
-		return fmt.Errorf("failed to create directory %s: %v", projectPath, err)
+		return fmt.Errorf("failed to create directory %s: %v", path.Dir(projectPath), err)
+	}
+	_, err = RemoveIncompleteClones(projectPath)
+	if err != nil {
+		return err
 	}
-	cloneCmd := fmt.Sprintf("git clone %s .", repo.SSHURLToRepo)
-	_, err = sh.ExecuteShellCommand(sh.DirectoryPath(projectPath), sh.ShellCommand(cloneCmd))
 
+	tempPath, err := os.MkdirTemp(path.Dir(projectPath), incompleteClonePrefix(projectPath))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary clone directory for %s: %v", projectPath, err)
+	}
+	err = clone(tempPath)
+	if err == nil {
+		err = moveIntoPlace(tempPath, projectPath)
+	}
+	if err != nil {
+		if removeErr := os.RemoveAll(tempPath); removeErr != nil {
+			Log.Errorf("failed to remove incomplete clone %s: %v", tempPath, removeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (repo *GitRepository) cloneInto(directory string) error {
+	cloneConfig := repo.CloneOptions.CloneConfig()
+	flags := CloneFlags(cloneConfig)
+	// Updating the mirror is part of the clone, it runs in the same clone slot and attempt
+	mirrorPath, err := repo.updateReferenceMirror()
+	if err != nil {
+		return err
+	}
+	if mirrorPath != "" {
+		// Objects are copied from the mirror, the working copy does not depend on it afterwards
+		flags = append(flags, "--reference-if-able="+mirrorPath, "--dissociate")
+	}
+	err = repo.git().Clone(repo.SSHURLToRepo, directory, flags)
 	if err != nil {
-		return fmt.Errorf("in %s, %s failed: %s", projectPath, cloneCmd, err)
+		return fmt.Errorf("in %s, git clone %s failed: %s", directory, repo.SSHURLToRepo, err)
+	}
+	return repo.setUpClone(directory)
+}
+
+// setUpClone applies sparse checkout and the archived marker to a fresh clone
+func (repo *GitRepository) setUpClone(directory string) error {
+	cloneConfig := repo.CloneOptions.CloneConfig()
+	if len(cloneConfig.SparseCheckout) > 0 {
+		err := repo.git().SetSparseCheckout(directory, cloneConfig.SparseCheckout)
+		if err != nil {
+			return fmt.Errorf("in %s, setting sparse checkout failed: %v", directory, err)
+		}
 	}
 
 	if repo.Archived {
-		err := repo.WriteArchivedMarker(projectPath)
+		err := repo.writeArchivedMarker(directory)
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
+// moveIntoPlace renames a finished clone to the working copy path. An empty directory left at the path by older
+// versions of gcm is replaced, anything else is kept and reported.
+func moveIntoPlace(clonePath string, projectPath string) error {
+	entries, err := os.ReadDir(projectPath)
+	if err == nil && len(entries) > 0 {
+		return fmt.Errorf("cannot move clone into place, %s already exists and is not empty", projectPath)
+	}
+	if err == nil {
+		if err := os.Remove(projectPath); err != nil {
+			return fmt.Errorf("failed to remove empty directory %s: %v", projectPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(clonePath, projectPath); err != nil {
+		return fmt.Errorf("failed to move clone %s into place at %s: %v", clonePath, projectPath, err)
+	}
 	return nil
 }
 
+func incompleteClonePrefix(projectPath string) string {
+	return "." + path.Base(projectPath) + ".gcm-clone-"
+}
+
+// RemoveIncompleteClones deletes temporary clone directories for projectPath left behind by crashed or killed runs
+func RemoveIncompleteClones(projectPath string) (int, error) {
+	leftovers, err := filepath.Glob(path.Join(path.Dir(projectPath), incompleteClonePrefix(projectPath)+"*"))
+	if err != nil {
+		return 0, err
+	}
+	for _, leftover := range leftovers {
+		Log.Warnf("Removing incomplete clone %s left by an earlier run", leftover)
+		if err := os.RemoveAll(leftover); err != nil {
+			return 0, fmt.Errorf("failed to remove incomplete clone %s: %v", leftover, err)
+		}
+	}
+	return len(leftovers), nil
+}
+
+// CloneFlags turns clone configuration into git clone flags
+func CloneFlags(config gitremote.CloneConfig) []string {
+	var flags []string
+	if config.Depth > 0 {
+		flags = append(flags, fmt.Sprintf("--depth=%d", config.Depth))
+	}
+	if config.Filter != "" {
+		flags = append(flags, "--filter="+config.Filter)
+	}
+	if config.SingleBranch {
+		flags = append(flags, "--single-branch")
+	} else if config.Depth > 0 {
+		// git clone --depth implies --single-branch
+		flags = append(flags, "--no-single-branch")
+	}
+	if config.Branch != "" {
+		flags = append(flags, "--branch="+config.Branch)
+	}
+	if config.RecurseSubmodules || config.ShallowSubmodules {
+		flags = append(flags, "--recurse-submodules")
+	}
+	if config.ShallowSubmodules {
+		flags = append(flags, "--shallow-submodules")
+	}
+	if config.SkipLfs {
+		// Stored in the repository config, so later checkouts keep leaving LFS content for gcm lfs pull
+		flags = append(
+			flags,
+			"--config=filter.lfs.smudge=git-lfs smudge --skip -- %f",
+			"--config=filter.lfs.process=git-lfs filter-process --skip",
+		)
+	}
+	if len(config.SparseCheckout) > 0 {
+		// Only files in the root directory are checked out until the sparse-checkout directories are set
+		flags = append(flags, "--sparse")
+	}
+	return flags
+}
+
+func (repo *GitRepository) MakeComplete() (bool, error) {
+	projectPath := repo.WorkingCopyPath()
+	completeness, err := repo.git().Completeness(projectPath)
+	if err != nil || completeness.IsComplete() {
+		return false, err
+	}
+	Log.Infof("Fetching full history of %s in %s (%+v)", repo.Name, projectPath, completeness)
+	err = repo.git().MakeComplete(projectPath)
+	if err != nil {
+		return false, fmt.Errorf("in %s, fetching full history failed: %v", projectPath, err)
+	}
+	return true, nil
+}
+
+// RunPostClone sets up a newly cloned working copy with configured git config values and commands
+func (repo *GitRepository) RunPostClone() error {
+	projectPath := repo.WorkingCopyPath()
+	postClone := repo.CloneOptions.CloneConfig().PostClone
+
+	keys := make([]string, 0, len(postClone.GitConfig))
+	for key := range postClone.GitConfig {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		err := repo.git().SetConfig(projectPath, key, postClone.GitConfig[key])
+		if err != nil {
+			return fmt.Errorf("in %s, setting git config %s failed: %v", projectPath, key, err)
+		}
+	}
+
+	for _, command := range postClone.Commands {
+		Log.Infof("Running post-clone command %q in %s", command, projectPath)
+		err := repo.git().RunCommand(projectPath, command)
+		if err != nil {
+			return fmt.Errorf("in %s, post-clone command %q failed: %v", projectPath, command, err)
+		}
+	}
+	return nil
+}
+
+// Fetch updates the remote-tracking branches of the working copy without touching checked out files
+func (repo *GitRepository) Fetch(options FetchOptions) error {
+	projectPath := repo.WorkingCopyPath()
+	Log.Debugf("Fetching %s in %s", repo.Name, projectPath)
+	if err := repo.git().Fetch(projectPath, options); err != nil {
+		return fmt.Errorf("in %s, git fetch failed: %v", projectPath, err)
+	}
+	return nil
+}
+
+// LfsPull downloads Git LFS content that was skipped when cloning, reporting whether the project is configured to skip it
+func (repo *GitRepository) LfsPull() (bool, error) {
+	if !repo.CloneOptions.CloneConfig().SkipLfs {
+		return false, nil
+	}
+	projectPath := repo.WorkingCopyPath()
+	Log.Infof("Pulling Git LFS content of %s in %s", repo.Name, projectPath)
+	err := repo.git().LfsPull(projectPath)
+	if err != nil {
+		return false, fmt.Errorf("in %s, git lfs pull failed: %v", projectPath, err)
+	}
+	return true, nil
+}
+
+// ApplySparseCheckout brings the sparse-checkout directories of a working copy in line with configuration, reporting whether they changed
+func (repo *GitRepository) ApplySparseCheckout() (bool, error) {
+	projectPath := repo.WorkingCopyPath()
+	configured := repo.CloneOptions.CloneConfig().SparseCheckout
+	current, err := repo.git().SparseCheckout(projectPath)
+	if err != nil {
+		return false, err
+	}
+	if current == nil && len(configured) == 0 {
+		return false, nil
+	}
+	if current != nil && slices.Equal(sortedCopy(current), sortedCopy(configured)) {
+		return false, nil
+	}
+	Log.Infof("Changing sparse checkout of %s in %s from %v to %v", repo.Name, projectPath, current, configured)
+	if err := repo.git().SetSparseCheckout(projectPath, configured); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func sortedCopy(values []string) []string {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return sorted
+}
+
 func (repo *GitRepository) CheckNeedsCloning() (bool, error) {
 	cloned, err := repo.IsCloned()
 	if err != nil {
@@ -74,7 +333,7 @@ func (repo *GitRepository) CheckNeedsCloning() (bool, error) {
 }
 
 func (repo *GitRepository) IsCloned() (bool, error) {
-	projectPath := repo.getWorkingCopyPath(repo.CloneOptions.CloneRootDirectory())
+	projectPath := repo.WorkingCopyPath()
 	gitDir, err := os.Stat(path.Join(projectPath, ".git"))
 	if os.IsNotExist(err) {
 		return false, nil
@@ -85,15 +344,64 @@ func (repo *GitRepository) IsCloned() (bool, error) {
 	return gitDir.IsDir(), nil
 }
 
-func (repo *GitRepository) getWorkingCopyPath(cloneDirectory string) string {
-	projectPath := path.Join(cloneDirectory, repo.PathWithNamespace)
+// WorkingCopyPath is where the layout places the working copy. Layouts are validated with the configuration,
+// should one still fail the full path with namespace is used.
+func (repo *GitRepository) WorkingCopyPath() string {
+	projectPath, err := repo.getWorkingCopyPath(repo.CloneOptions.CloneRootDirectory())
+	if err != nil {
+		Log.Errorf("%v, using full path", err)
+		return path.Join(repo.CloneOptions.CloneRootDirectory(), repo.PathWithNamespace)
+	}
 	return projectPath
 }
 
-// WriteArchivedMarker creates an "ARCHIVED.txt" file in the root directory of the archived project
-func (repo *GitRepository) WriteArchivedMarker(projectPath string) error {
+func (repo *GitRepository) CheckWorkingCopyPath() error {
+	_, err := repo.getWorkingCopyPath(repo.CloneOptions.CloneRootDirectory())
+	return err
+}
+
+func (repo *GitRepository) getWorkingCopyPath(cloneDirectory string) (string, error) {
+	relativePath, err := LayoutPath(repo.CloneOptions.Layout(), repo.PathWithNamespace)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(cloneDirectory, relativePath), nil
+}
+
+func (repo *GitRepository) GetSSHURLToRepo() string {
+	return repo.SSHURLToRepo
+}
+
+const ArchivedMarkerFileName = "ARCHIVED.txt"
+
+// SyncArchivedMarker adds or removes the ARCHIVED.txt marker of a working copy when the project has been archived
+// or unarchived since, reporting whether it did.
+func (repo *GitRepository) SyncArchivedMarker() (bool, error) {
+	if !repo.ArchivedKnown {
+		return false, nil
+	}
+	projectPath := repo.WorkingCopyPath()
+	markerFilePath := path.Join(projectPath, ArchivedMarkerFileName)
+	_, err := os.Stat(markerFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	hasMarker := err == nil
+	if hasMarker == repo.Archived {
+		return false, nil
+	}
+	if repo.Archived {
+		Log.Infof("%s has been archived, adding %s", projectPath, ArchivedMarkerFileName)
+		return true, repo.writeArchivedMarker(projectPath)
+	}
+	Log.Infof("%s is no longer archived, removing %s", projectPath, ArchivedMarkerFileName)
+	return true, os.Remove(markerFilePath)
+}
+
+// writeArchivedMarker creates an "ARCHIVED.txt" file in the root directory of the archived project
+func (repo *GitRepository) writeArchivedMarker(projectPath string) error {
 	// Define the path for the ARCHIVED.txt marker file
-	markerFilePath := path.Join(projectPath, "ARCHIVED.txt")
+	markerFilePath := path.Join(projectPath, ArchivedMarkerFileName)
 
 	// Create the marker file
 	file, err := os.Create(markerFilePath)
@@ -127,28 +435,48 @@ func (repo *GitRepository) cloneArchived() bool {
 
 type RemoteCloneOptions struct {
 	cloneDirectory string
+	layout         string
+	cloneConfig    gitremote.CloneConfig
+}
+
+func (rco RemoteCloneOptions) Layout() string {
+	return rco.layout
 }
 
 func (rco RemoteCloneOptions) CloneRootDirectory() string {
 	return rco.cloneDirectory
 }
 
+func (rco RemoteCloneOptions) CloneConfig() gitremote.CloneConfig {
+	return rco.cloneConfig
+}
+
 func (_ RemoteCloneOptions) CloneArchived() bool {
 	return true
 }
 
+// NewRemoteCloneOptions places a working copy with layout below cloneDirectory and clones it with cloneConfig,
+// archived or not
+func NewRemoteCloneOptions(cloneDirectory string, layout string, cloneConfig gitremote.CloneConfig) RemoteCloneOptions {
+	return RemoteCloneOptions{cloneDirectory: cloneDirectory, layout: layout, cloneConfig: cloneConfig}
+}
+
 func CreateFromGitRemoteConfig(
 	project gitremote.GitRemoteProjectConfig,
 	hostName string,
 	cloneDirectory string,
+	layout string,
+	backend Backend,
 ) *GitRepository {
-	opts := RemoteCloneOptions{cloneDirectory: cloneDirectory}
+	opts := NewRemoteCloneOptions(cloneDirectory, layout, project.CloneConfig)
 
 	var gitRepo = GitRepository{
 		Name:              project.Name,
 		PathWithNamespace: project.FullPath,
 		SSHURLToRepo:      fmt.Sprintf("git@%s:%s", hostName, project.FullPath),
 		CloneOptions:      opts,
+		Backend:           backend,
+		HostName:          hostName,
 	}
 	return &gitRepo
 }
@@ -0,0 +1,164 @@
+package gitrepo
+
+import (
+	"fmt"
+	"gcm/internal/gitremote"
+	"os"
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestCloneFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   gitremote.CloneConfig
+		expected []string
+	}{
+		{
+			name:     "Defaults to a full clone",
+			config:   gitremote.CloneConfig{},
+			expected: nil,
+		},
+		{
+			name:     "Shallow clone keeps all branches",
+			config:   gitremote.CloneConfig{Depth: 1},
+			expected: []string{"--depth=1", "--no-single-branch"},
+		},
+		{
+			name:     "Partial single branch clone",
+			config:   gitremote.CloneConfig{Filter: "blob:none", SingleBranch: true, Branch: "develop"},
+			expected: []string{"--filter=blob:none", "--single-branch", "--branch=develop"},
+		},
+		{
+			name:   "Shallow submodules without LFS content",
+			config: gitremote.CloneConfig{ShallowSubmodules: true, SkipLfs: true},
+			expected: []string{
+				"--recurse-submodules",
+				"--shallow-submodules",
+				"--config=filter.lfs.smudge=git-lfs smudge --skip -- %f",
+				"--config=filter.lfs.process=git-lfs filter-process --skip",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := CloneFlags(tt.config)
+			if !slices.Equal(flags, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, flags)
+			}
+		})
+	}
+}
+
+func TestMakeComplete(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	backend.AddRemote("git@example.com:team/app", FakeRemote{Branches: []string{"main"}})
+	repo := CreateFromGitRemoteConfig(
+		gitremote.GitRemoteProjectConfig{
+			Name:        "app",
+			FullPath:    "team/app",
+			CloneConfig: gitremote.CloneConfig{Depth: 1, Filter: "tree:0"},
+		},
+		"example.com",
+		cloneDirectory,
+		"",
+		backend,
+	)
+	if err := repo.Clone(); err != nil {
+		t.Fatalf("clone failed: %v", err)
+	}
+
+	converted, err := repo.MakeComplete()
+	if err != nil || !converted {
+		t.Errorf("expected shallow partial clone to be converted, got %v, %v", converted, err)
+	}
+	converted, err = repo.MakeComplete()
+	if err != nil || converted {
+		t.Errorf("expected full clone to be left alone, got %v, %v", converted, err)
+	}
+}
+
+func TestClone_IsAtomic(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	remote := backend.AddRemote(
+		"git@example.com:team/app",
+		FakeRemote{Branches: []string{"main"}, CloneError: fmt.Errorf("fatal: the remote end hung up unexpectedly")},
+	)
+	repo := CreateFromGitRemoteConfig(
+		gitremote.GitRemoteProjectConfig{Name: "app", FullPath: "team/app"}, "example.com", cloneDirectory, "", backend,
+	)
+	projectPath := path.Join(cloneDirectory, "team/app")
+
+	if err := repo.Clone(); err == nil {
+		t.Fatalf("expected clone to fail")
+	}
+	entries, _ := os.ReadDir(path.Join(cloneDirectory, "team"))
+	if len(entries) != 0 {
+		t.Errorf("expected failed clone to leave nothing behind, found %v", entries)
+	}
+
+	// Simulate a run killed while cloning, and an empty directory from older versions
+	leftover := path.Join(cloneDirectory, "team", ".app.gcm-clone-123")
+	if err := os.MkdirAll(path.Join(leftover, ".git"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(projectPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	remote.CloneError = nil
+	if err := repo.Clone(); err != nil {
+		t.Fatalf("expected clone to succeed, got %v", err)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("expected incomplete clone %s to be removed", leftover)
+	}
+	if cloned, _ := repo.IsCloned(); !cloned {
+		t.Errorf("expected app to be cloned")
+	}
+}
+
+func TestSyncArchivedMarker(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	backend.AddRemote("git@example.com:team/app", FakeRemote{Branches: []string{"main"}})
+	repo := &GitRepository{
+		Name:              "app",
+		SSHURLToRepo:      "git@example.com:team/app",
+		PathWithNamespace: "team/app",
+		ArchivedKnown:     true,
+		CloneOptions:      RemoteCloneOptions{cloneDirectory: cloneDirectory},
+		Backend:           backend,
+	}
+	if err := repo.Clone(); err != nil {
+		t.Fatal(err)
+	}
+	markerPath := path.Join(repo.WorkingCopyPath(), ArchivedMarkerFileName)
+
+	if changed, err := repo.SyncArchivedMarker(); changed || err != nil {
+		t.Errorf("expected no change for an active project, got %v, %v", changed, err)
+	}
+
+	repo.Archived = true
+	if changed, err := repo.SyncArchivedMarker(); !changed || err != nil {
+		t.Errorf("expected marker to be added, got %v, %v", changed, err)
+	}
+	if _, err := os.Stat(markerPath); err != nil {
+		t.Errorf("expected archived marker: %v", err)
+	}
+	if changed, _ := repo.SyncArchivedMarker(); changed {
+		t.Errorf("expected no change when marker is already there")
+	}
+
+	repo.Archived = false
+	if changed, err := repo.SyncArchivedMarker(); !changed || err != nil {
+		t.Errorf("expected marker to be removed, got %v, %v", changed, err)
+	}
+	if _, err := os.Stat(markerPath); !os.IsNotExist(err) {
+		t.Errorf("expected archived marker to be removed")
+	}
+}
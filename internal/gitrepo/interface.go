@@ -1,11 +1,50 @@
 package gitrepo
 
+import "gcm/internal/gitremote"
+
 type GitRepo interface {
 	GetName() string
+	WorkingCopyPath() string
+	// CheckWorkingCopyPath reports a layout that cannot place the working copy
+	CheckWorkingCopyPath() error
+	GetSSHURLToRepo() string
+	GetPathWithNamespace() string
+	// GetGroupPath is the full path of the provider group the project is in, empty when not known
+	GetGroupPath() string
+	// GetProjectID is the ID of the project at the provider, 0 when not known
+	GetProjectID() int
+	GetHostName() string
+	// GetReferenceCache is the directory with bare mirrors to clone from, empty without a reference cache
+	GetReferenceCache() string
+	// GetForkOf is the URL of the project this one is a fork of, empty when it is not a fork
+	GetForkOf() string
 	Clone() error
+	// RunPostClone sets up a working copy right after it was cloned
+	RunPostClone() error
+	// MakeComplete converts a shallow, partial or single branch clone to a full clone, reporting whether it had to
+	MakeComplete() (bool, error)
+	// ApplySparseCheckout re-applies configured sparse-checkout directories to a working copy, reporting whether they changed
+	ApplySparseCheckout() (bool, error)
+	// SyncWorktrees adds and removes worktrees of a working copy to match configured branches, reporting how many
+	SyncWorktrees() (added int, removed int, err error)
+	// Fetch updates remote-tracking branches of a working copy
+	Fetch(options FetchOptions) error
+	// LfsPull downloads Git LFS content skipped when cloning, reporting whether there was any to skip
+	LfsPull() (bool, error)
 	CheckNeedsCloning() (bool, error)
 	IsCloned() (bool, error)
-	WriteArchivedMarker(projectPath string) error
+	// Diagnose finds the most severe problem with an existing working copy, nil when there is none
+	Diagnose() (*Problem, error)
+	Repair(problem Problem) error
+	// OriginDrift reports the origin URL of the working copy when the provider reports another one
+	OriginDrift() (string, error)
+	FixOrigin() error
+	// SyncArchivedMarker adds or removes the archived marker of a working copy to match the provider, reporting whether it changed
+	SyncArchivedMarker() (bool, error)
+	// CreateBundle writes all refs to a git bundle file, reporting false when there are no commits to bundle
+	CreateBundle(bundlePath string) (bool, error)
+	// DiskUsage measures the working copy
+	DiskUsage() (DiskUsage, error)
 	IsArchived() bool
 	GetCloneOptions() CloneOptions
 }
@@ -13,5 +52,8 @@ type GitRepo interface {
 type CloneOptions interface {
 	CloneArchived() bool
 	CloneRootDirectory() string
+	// Layout is the template for the working copy path below CloneRootDirectory, see LayoutPath
+	Layout() string
+	CloneConfig() gitremote.CloneConfig
 	// ... add project metadata
 }
@@ -0,0 +1,78 @@
+package gitrepo
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DefaultLayout places working copies at their full path with namespace below the clone directory
+const DefaultLayout = "{{.FullPath}}"
+
+// LayoutData What a layout template can use to place a working copy below the clone directory,
+// e.g. for the project group/subgroup/deeper/project
+type LayoutData struct {
+	FullPath         string // group/subgroup/deeper/project
+	RootGroup        string // group
+	SubGroups        string // subgroup/deeper
+	WithoutRootGroup string // subgroup/deeper/project
+	Project          string // project
+}
+
+func NewLayoutData(pathWithNamespace string) LayoutData {
+	parts := strings.Split(pathWithNamespace, "/")
+	data := LayoutData{
+		FullPath: pathWithNamespace,
+		Project:  parts[len(parts)-1],
+	}
+	if len(parts) > 1 {
+		data.RootGroup = parts[0]
+		data.WithoutRootGroup = strings.Join(parts[1:], "/")
+		data.SubGroups = strings.Join(parts[1:len(parts)-1], "/")
+	} else {
+		data.WithoutRootGroup = pathWithNamespace
+	}
+	return data
+}
+
+var parsedLayouts sync.Map
+
+func parseLayout(layout string) (*template.Template, error) {
+	if parsed, ok := parsedLayouts.Load(layout); ok {
+		return parsed.(*template.Template), nil
+	}
+	parsed, err := template.New("layout").Option("missingkey=error").Parse(layout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid layout %q: %v", layout, err)
+	}
+	parsedLayouts.Store(layout, parsed)
+	return parsed, nil
+}
+
+// LayoutPath applies a layout template to a project path, giving the working copy path relative to the clone directory
+func LayoutPath(layout string, pathWithNamespace string) (string, error) {
+	if layout == "" {
+		layout = DefaultLayout
+	}
+	parsed, err := parseLayout(layout)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := parsed.Execute(&out, NewLayoutData(pathWithNamespace)); err != nil {
+		return "", fmt.Errorf("invalid layout %q: %v", layout, err)
+	}
+	relativePath := path.Clean(strings.TrimSpace(out.String()))
+	if relativePath == "." || path.IsAbs(relativePath) || strings.HasPrefix(relativePath, "..") {
+		return "", fmt.Errorf("layout %q places %s outside the clone directory (%q)", layout, pathWithNamespace, out.String())
+	}
+	return relativePath, nil
+}
+
+// ValidateLayout checks a layout template before anything is cloned with it
+func ValidateLayout(layout string) error {
+	_, err := LayoutPath(layout, "group/subgroup/project")
+	return err
+}
@@ -0,0 +1,114 @@
+package gitrepo
+
+import (
+	"gcm/internal/gitremote"
+	"slices"
+	"testing"
+)
+
+func TestLayoutPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		layout   string
+		expected string
+	}{
+		{name: "Default layout", layout: "", expected: "group/sub/deeper/project"},
+		{name: "Strip root group", layout: "{{.WithoutRootGroup}}", expected: "sub/deeper/project"},
+		{name: "Drop subgroups", layout: "{{.RootGroup}}/{{.Project}}", expected: "group/project"},
+		{name: "Flatten", layout: "{{.Project}}", expected: "project"},
+		{name: "Subgroups only", layout: "{{.SubGroups}}/{{.Project}}", expected: "sub/deeper/project"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := LayoutPath(tt.layout, "group/sub/deeper/project")
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateLayout(t *testing.T) {
+	for _, layout := range []string{"{{.Project", "{{.NoSuchField}}", "../{{.Project}}", "/tmp/{{.Project}}", " "} {
+		if err := ValidateLayout(layout); err == nil {
+			t.Errorf("expected layout %q to be invalid", layout)
+		}
+	}
+}
+
+func TestDetectPathCollisions(t *testing.T) {
+	newRepo := func(name string, fullPath string) GitRepo {
+		return CreateFromGitRemoteConfig(
+			gitremote.GitRemoteProjectConfig{Name: name, FullPath: fullPath}, "example.com", "clones", "{{.Project}}", nil,
+		)
+	}
+	repos := []GitRepo{
+		newRepo("unique", "a/b/unique"),
+		newRepo("api", "a/payments/api"),
+		newRepo("api", "a/orders/api"),
+		newRepo("twice", "a/twice"),
+		newRepo("twice", "a/twice"),
+		newRepo("api-docs", "a/api-docs"),
+	}
+	repoChannel := make(chan GitRepo, len(repos))
+	for _, repo := range repos {
+		repoChannel <- repo
+	}
+	close(repoChannel)
+	errorChannel := make(chan error, 10)
+
+	var passed []string
+	for repo := range DetectPathCollisions(repoChannel, nil, errorChannel) {
+		passed = append(passed, repo.WorkingCopyPath())
+	}
+
+	expected := []string{"clones/api-docs", "clones/twice", "clones/unique"}
+	if len(passed) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, passed)
+	}
+	for i := range expected {
+		if passed[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, passed)
+		}
+	}
+	if len(errorChannel) != 1 {
+		t.Errorf("expected 1 collision error, got %d", len(errorChannel))
+	}
+}
+
+func TestDetectPathCollisions_Nested(t *testing.T) {
+	repoChannel := make(chan GitRepo, 3)
+	for _, fullPath := range []string{"g/x", "h/x/y", "h/x-z"} {
+		repoChannel <- CreateFromGitRemoteConfig(
+			gitremote.GitRemoteProjectConfig{Name: fullPath, FullPath: fullPath},
+			"example.com", "clones", "{{.WithoutRootGroup}}", nil,
+		)
+	}
+	close(repoChannel)
+	errorChannel := make(chan error, 10)
+	report := NewRunReport()
+
+	var passed []string
+	for repo := range DetectPathCollisions(repoChannel, report, errorChannel) {
+		passed = append(passed, repo.GetName())
+	}
+	if len(passed) != 1 || passed[0] != "h/x-z" {
+		t.Errorf("expected only h/x-z to pass, got %v", passed)
+	}
+	if len(errorChannel) != 2 {
+		t.Errorf("expected 2 collision errors, got %d", len(errorChannel))
+	}
+	var failed []string
+	for _, entry := range report.Entries() {
+		if entry.Outcome == OutcomeFailed {
+			failed = append(failed, entry.Name)
+		}
+	}
+	if !slices.Equal(failed, []string{"g/x", "h/x/y"}) {
+		t.Errorf("expected g/x and h/x/y to be recorded as failed, got %v", failed)
+	}
+}
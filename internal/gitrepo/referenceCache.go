@@ -0,0 +1,57 @@
+package gitrepo
+
+import (
+	"fmt"
+	. "gcm/internal/log"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Mirrors are updated by one clone at a time, forks of a project share the mirror of the project
+var mirrorLocks sync.Map
+
+// MirrorPath places the bare mirror for a repository URL in the reference cache, e.g.
+// gitlab.com/group/project.git for git@gitlab.com:group/project.git
+func MirrorPath(cacheDirectory string, url string) string {
+	name := url
+	if _, afterScheme, found := strings.Cut(name, "://"); found {
+		name = afterScheme
+	}
+	if user, afterUser, found := strings.Cut(name, "@"); found && !strings.ContainsAny(user, "/:") {
+		name = afterUser
+	}
+	name = strings.TrimSuffix(strings.Replace(name, ":", "/", 1), ".git")
+	// Cleaning an absolute path keeps .. in a URL from leaving the cache directory
+	return path.Join(cacheDirectory, path.Clean("/"+name)+".git")
+}
+
+// updateReferenceMirror fetches the repository into its mirror in the reference cache and returns the mirror path,
+// empty when there is no reference cache or the mirror could not be updated. Shallow and partial clones do without
+// the mirror, it would fetch the full history they leave out. Clones work without the mirror, only slower, so
+// failures are logged and not returned, except transient ones: the clone over the same connection would fail as well,
+// and failing the attempt leaves it to retries and the adaptive rate.
+func (repo *GitRepository) updateReferenceMirror() (string, error) {
+	cloneConfig := repo.CloneOptions.CloneConfig()
+	if repo.ReferenceCache == "" || cloneConfig.Depth > 0 || cloneConfig.Filter != "" {
+		return "", nil
+	}
+	mirrorPath := MirrorPath(repo.ReferenceCache, repo.SSHURLToRepo)
+	if repo.ForkOf != "" {
+		mirrorPath = MirrorPath(repo.ReferenceCache, repo.ForkOf)
+	}
+	lock, _ := mirrorLocks.LoadOrStore(mirrorPath, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	Log.Infof("Updating reference mirror %s with %s", mirrorPath, repo.SSHURLToRepo)
+	err := repo.git().UpdateMirror(mirrorPath, repo.PathWithNamespace, repo.SSHURLToRepo)
+	if IsTransientCloneError(err) {
+		return "", fmt.Errorf("updating reference mirror %s failed: %v", mirrorPath, err)
+	}
+	if err != nil {
+		Log.Warnf("Updating reference mirror %s failed, cloning %s without it: %v", mirrorPath, repo.Name, err)
+		return "", nil
+	}
+	return mirrorPath, nil
+}
@@ -0,0 +1,93 @@
+package gitrepo
+
+import (
+	"gcm/internal/gitremote"
+	"slices"
+	"testing"
+)
+
+func TestMirrorPath(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"git@gitlab.com:group/project.git", "/cache/gitlab.com/group/project.git"},
+		{"git@gitlab.com:group/sub/project", "/cache/gitlab.com/group/sub/project.git"},
+		{"ssh://git@gitlab.com:2222/group/project.git", "/cache/gitlab.com/2222/group/project.git"},
+		{"https://gitlab.com/group/project.git", "/cache/gitlab.com/group/project.git"},
+		{"git@gitlab.com:../../etc/project", "/cache/etc/project.git"},
+	}
+	for _, tt := range tests {
+		if mirrorPath := MirrorPath("/cache", tt.url); mirrorPath != tt.expected {
+			t.Errorf("expected mirror of %s at %s, got %s", tt.url, tt.expected, mirrorPath)
+		}
+	}
+}
+
+func TestClone_ForksShareReferenceMirror(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	cacheDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	newRepo := func(fullPath string, forkOf string) *GitRepository {
+		url := "git@example.com:" + fullPath
+		backend.AddRemote(url, FakeRemote{Branches: []string{"main"}})
+		repo := CreateFromGitRemoteConfig(
+			gitremote.GitRemoteProjectConfig{Name: fullPath, FullPath: fullPath}, "example.com", cloneDirectory, "", backend,
+		)
+		repo.ReferenceCache = cacheDirectory
+		repo.ForkOf = forkOf
+		return repo
+	}
+	upstream := newRepo("team/app", "")
+	fork := newRepo("me/app", "git@example.com:team/app")
+
+	for _, repo := range []*GitRepository{upstream, fork} {
+		if err := repo.Clone(); err != nil {
+			t.Fatalf("clone of %s failed: %v", repo.Name, err)
+		}
+		mirrorPath := cacheDirectory + "/example.com/team/app.git"
+		flags, _ := backend.CloneFlags(repo.WorkingCopyPath())
+		if !slices.Contains(flags, "--reference-if-able="+mirrorPath) || !slices.Contains(flags, "--dissociate") {
+			t.Errorf("expected %s to be cloned with reference to %s, got %v", repo.Name, mirrorPath, flags)
+		}
+	}
+	names := backend.MirrorNames(cacheDirectory + "/example.com/team/app.git")
+	if !slices.Equal(names, []string{"team/app", "me/app"}) {
+		t.Errorf("expected fork to be fetched into the mirror of its upstream project, got %v", names)
+	}
+}
+
+func TestClone_ReferenceMirror(t *testing.T) {
+	cacheDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	newRepo := func(name string, cloneConfig gitremote.CloneConfig) *GitRepository {
+		repo := CreateFromGitRemoteConfig(
+			gitremote.GitRemoteProjectConfig{Name: name, FullPath: "team/" + name, CloneConfig: cloneConfig},
+			"example.com",
+			t.TempDir(),
+			"",
+			backend,
+		)
+		repo.ReferenceCache = cacheDirectory
+		return repo
+	}
+
+	backend.AddRemote("git@example.com:team/shallow", FakeRemote{Branches: []string{"main"}})
+	backend.AddRemote("git@example.com:team/partial", FakeRemote{Branches: []string{"main"}})
+	for _, repo := range []*GitRepository{
+		newRepo("shallow", gitremote.CloneConfig{Depth: 1}),
+		newRepo("partial", gitremote.CloneConfig{Filter: "blob:none"}),
+	} {
+		if err := repo.Clone(); err != nil {
+			t.Fatalf("clone of %s failed: %v", repo.Name, err)
+		}
+		if names := backend.MirrorNames(MirrorPath(cacheDirectory, repo.SSHURLToRepo)); len(names) > 0 {
+			t.Errorf("expected %s to be cloned without updating the mirror, got %v", repo.Name, names)
+		}
+	}
+
+	backend.AddRemote("git@example.com:team/throttled", FakeRemote{CloneError: errKexReset})
+	if err := newRepo("throttled", gitremote.CloneConfig{}).Clone(); !IsSSHConnectionFailure(err) {
+		t.Errorf("expected the connection failure updating the mirror to fail the clone, got %v", err)
+	}
+}
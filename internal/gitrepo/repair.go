@@ -0,0 +1,161 @@
+package gitrepo
+
+import (
+	"fmt"
+	. "gcm/internal/log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type ProblemKind int
+
+const (
+	MissingGitDirectory ProblemKind = iota
+	BrokenRepository
+	UnbornHead
+	UnexpectedOrigin
+)
+
+// Problem Something wrong with an existing working copy, found by Diagnose
+type Problem struct {
+	Kind   ProblemKind
+	Detail string
+}
+
+func (p Problem) String() string {
+	switch p.Kind {
+	case MissingGitDirectory:
+		return "directory exists but has no .git directory"
+	case BrokenRepository:
+		return fmt.Sprintf("repository is broken: %s", p.Detail)
+	case UnbornHead:
+		return "no commits checked out although the remote has commits"
+	case UnexpectedOrigin:
+		return fmt.Sprintf("origin points to %s", p.Detail)
+	}
+	return p.Detail
+}
+
+// Fix describes what Repair does about the problem
+func (p Problem) Fix() string {
+	if p.Kind == UnexpectedOrigin {
+		return "fix remote"
+	}
+	return "re-clone"
+}
+
+// Diagnose checks a working copy for problems, most severe first. Missing working copies are not a problem.
+func (repo *GitRepository) Diagnose() (*Problem, error) {
+	projectPath := repo.WorkingCopyPath()
+	if _, err := os.Stat(projectPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	cloned, err := repo.IsCloned()
+	if err != nil {
+		return nil, err
+	}
+	if !cloned {
+		return &Problem{Kind: MissingGitDirectory}, nil
+	}
+
+	if err := repo.git().Fsck(projectPath); err != nil {
+		return &Problem{Kind: BrokenRepository, Detail: err.Error()}, nil
+	}
+
+	hasCommits, err := repo.git().HasCommits(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	if !hasCommits {
+		remoteHasCommits, err := repo.git().RemoteHasCommits(projectPath, OriginRemote)
+		if err != nil {
+			return nil, err
+		}
+		if remoteHasCommits {
+			return &Problem{Kind: UnbornHead}, nil
+		}
+	}
+
+	origin, err := repo.OriginDrift()
+	if err != nil {
+		return nil, err
+	}
+	if origin != "" {
+		return &Problem{Kind: UnexpectedOrigin, Detail: origin}, nil
+	}
+	return nil, nil
+}
+
+// OriginDrift reports the origin URL of the working copy when it is not the one the provider reports, empty when it is
+func (repo *GitRepository) OriginDrift() (string, error) {
+	origin, err := repo.git().RemoteURL(repo.WorkingCopyPath(), OriginRemote)
+	if err != nil || origin == repo.SSHURLToRepo {
+		return "", err
+	}
+	return origin, nil
+}
+
+// FixOrigin points origin of the working copy to the URL the provider reports
+func (repo *GitRepository) FixOrigin() error {
+	projectPath := repo.WorkingCopyPath()
+	Log.Infof("Setting origin of %s to %s", projectPath, repo.SSHURLToRepo)
+	err := repo.git().SetRemoteURL(projectPath, OriginRemote, repo.SSHURLToRepo)
+	if err != nil {
+		return fmt.Errorf("in %s, setting origin to %s failed: %v", projectPath, repo.SSHURLToRepo, err)
+	}
+	return nil
+}
+
+// Repair fixes a problem found by Diagnose. Working copies are re-cloned after moving the old directory and its
+// worktrees aside, so nothing in them is lost, and set up like a new clone. Archived projects are re-cloned as well,
+// their working copy exists after all.
+func (repo *GitRepository) Repair(problem Problem) error {
+	if problem.Kind == UnexpectedOrigin {
+		return repo.FixOrigin()
+	}
+
+	projectPath := repo.WorkingCopyPath()
+	brokenPath := fmt.Sprintf("%s.gcm-broken-%d", projectPath, time.Now().Unix())
+	Log.Infof("Moving broken working copy %s to %s before cloning again", projectPath, path.Base(brokenPath))
+	if err := os.Rename(projectPath, brokenPath); err != nil {
+		return fmt.Errorf("failed to move broken working copy %s aside: %v", projectPath, err)
+	}
+	if err := moveWorktreesAside(projectPath, brokenPath); err != nil {
+		return err
+	}
+	if err := cloneAtomically(projectPath, repo.cloneInto); err != nil {
+		return err
+	}
+	if err := repo.RunPostClone(); err != nil {
+		return fmt.Errorf("post-clone setup failed: %v", err)
+	}
+	if _, _, err := repo.SyncWorktrees(); err != nil {
+		return fmt.Errorf("post-clone setup failed: %v", err)
+	}
+	return nil
+}
+
+// moveWorktreesAside moves the linked worktrees of a working copy moved to brokenPath along with it, e.g.
+// project@release-1.0 to project.gcm-broken-<time>@release-1.0. They belong to the moved repository, left in place
+// they would keep pointing to it and stop the re-cloned working copy from adding its own.
+func moveWorktreesAside(projectPath string, brokenPath string) error {
+	worktrees, err := filepath.Glob(globEscape(projectPath) + worktreeSeparator + "*")
+	if err != nil {
+		return err
+	}
+	for _, worktreePath := range worktrees {
+		// A linked worktree has a .git file pointing to the repository, anything else is not gcm's to move
+		if gitFile, err := os.Stat(path.Join(worktreePath, ".git")); err != nil || gitFile.IsDir() {
+			continue
+		}
+		asidePath := brokenPath + strings.TrimPrefix(worktreePath, projectPath)
+		Log.Infof("Moving worktree %s of the broken working copy to %s", worktreePath, path.Base(asidePath))
+		if err := os.Rename(worktreePath, asidePath); err != nil {
+			return fmt.Errorf("failed to move worktree %s aside: %v", worktreePath, err)
+		}
+	}
+	return nil
+}
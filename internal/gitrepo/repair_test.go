@@ -0,0 +1,112 @@
+package gitrepo
+
+import (
+	"gcm/internal/gitremote"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiagnoseAndRepair(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	newRepo := func(name string) *GitRepository {
+		backend.AddRemote("git@example.com:team/"+name, FakeRemote{Branches: []string{"main"}, Commits: 3})
+		return CreateFromGitRemoteConfig(
+			gitremote.GitRemoteProjectConfig{Name: name, FullPath: "team/" + name}, "example.com", cloneDirectory, "", backend,
+		)
+	}
+
+	healthy := newRepo("healthy")
+	notCloned := newRepo("notCloned")
+	noGit := newRepo("noGit")
+	corrupt := newRepo("corrupt")
+	moved := newRepo("moved")
+	for _, repo := range []*GitRepository{healthy, corrupt, moved} {
+		if err := repo.Clone(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(noGit.WorkingCopyPath(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(noGit.WorkingCopyPath(), "notes.txt"), []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = backend.Corrupt(corrupt.WorkingCopyPath())
+	_ = backend.SetRemoteURL(moved.WorkingCopyPath(), OriginRemote, "git@old.example.com:team/moved")
+
+	expected := map[*GitRepository]*ProblemKind{
+		healthy:   nil,
+		notCloned: nil,
+		noGit:     ptr(MissingGitDirectory),
+		corrupt:   ptr(BrokenRepository),
+		moved:     ptr(UnexpectedOrigin),
+	}
+	for repo, kind := range expected {
+		problem, err := repo.Diagnose()
+		if err != nil {
+			t.Fatalf("unexpected error diagnosing %s: %v", repo.Name, err)
+		}
+		if (problem == nil) != (kind == nil) || (problem != nil && problem.Kind != *kind) {
+			t.Errorf("unexpected diagnosis for %s: %v", repo.Name, problem)
+		}
+		if problem == nil {
+			continue
+		}
+		if err := repo.Repair(*problem); err != nil {
+			t.Errorf("failed to repair %s: %v", repo.Name, err)
+		}
+		if problem, _ = repo.Diagnose(); problem != nil {
+			t.Errorf("expected %s to be repaired, still %v", repo.Name, problem)
+		}
+	}
+
+	aside, _ := filepath.Glob(path.Join(cloneDirectory, "team", "noGit.gcm-broken-*", "notes.txt"))
+	if len(aside) != 1 {
+		t.Errorf("expected broken working copy to be moved aside with its files, got %v", aside)
+	}
+}
+
+func TestRepair_MovesWorktreesAside(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	backend.AddRemote("git@example.com:team/app", FakeRemote{Branches: []string{"main", "release/1.0"}, Commits: 3})
+	repo := CreateFromGitRemoteConfig(
+		gitremote.GitRemoteProjectConfig{
+			Name:        "app",
+			FullPath:    "team/app",
+			CloneConfig: gitremote.CloneConfig{Worktrees: []string{"release/*"}},
+		},
+		"example.com", cloneDirectory, "", backend,
+	)
+	if err := repo.Clone(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.SyncWorktrees(); err != nil {
+		t.Fatal(err)
+	}
+	worktreePath := WorktreePath(repo.WorkingCopyPath(), "release/1.0")
+	if err := os.WriteFile(path.Join(worktreePath, "wip.txt"), []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = backend.Corrupt(repo.WorkingCopyPath())
+
+	if err := repo.Repair(Problem{Kind: BrokenRepository}); err != nil {
+		t.Fatalf("failed to repair: %v", err)
+	}
+
+	worktrees, err := backend.Worktrees(repo.WorkingCopyPath())
+	if err != nil || len(worktrees) != 1 || worktrees[0] != worktreePath {
+		t.Errorf("expected the re-cloned working copy to add worktree %s, got %v, %v", worktreePath, worktrees, err)
+	}
+	aside, _ := filepath.Glob(path.Join(cloneDirectory, "team", "app.gcm-broken-*@release-1.0", "wip.txt"))
+	if len(aside) != 1 {
+		t.Errorf("expected the old worktree to be moved aside with its files, got %v", aside)
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
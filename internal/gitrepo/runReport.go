@@ -0,0 +1,117 @@
+package gitrepo
+
+import (
+	"cmp"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Outcome What a run did with a repository
+type Outcome string
+
+const (
+	OutcomeCloned          Outcome = "cloned"
+	OutcomeAlreadyCloned   Outcome = "already cloned"
+	OutcomeSkippedArchived Outcome = "skipped archived"
+	OutcomeFailed          Outcome = "failed"
+)
+
+// RunReportEntry The outcome for one repository, Error is empty unless it failed
+type RunReportEntry struct {
+	HostName          string
+	Group             string // Namespace of the project, e.g. group/subgroup
+	Name              string
+	PathWithNamespace string
+	Path              string
+	Outcome           Outcome
+	Error             string
+	Duration          time.Duration
+}
+
+// RunReport collects the outcome of every repository a run processed. Recording to a nil RunReport does nothing.
+type RunReport struct {
+	mutex   sync.Mutex
+	Started time.Time
+	entries []RunReportEntry
+	indexes map[runReportKey]int // Index of the entry of each repository in entries
+}
+
+type runReportKey struct {
+	hostName          string
+	pathWithNamespace string
+	path              string
+}
+
+func NewRunReport() *RunReport {
+	return &RunReport{Started: time.Now(), indexes: make(map[runReportKey]int)}
+}
+
+func (report *RunReport) Record(repo GitRepo, outcome Outcome, duration time.Duration, err error) {
+	if report == nil {
+		return
+	}
+	entry := RunReportEntry{
+		HostName:          repo.GetHostName(),
+		Group:             path.Dir(repo.GetPathWithNamespace()),
+		Name:              repo.GetName(),
+		PathWithNamespace: repo.GetPathWithNamespace(),
+		Path:              repo.WorkingCopyPath(),
+		Outcome:           outcome,
+		Duration:          duration,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	report.add(entry)
+}
+
+// RecordFailed records a failure for something that is no repository yet, e.g. a group whose projects could not be
+// fetched or a plan entry that cannot be applied. Outcome and Error of entry are set from err.
+func (report *RunReport) RecordFailed(entry RunReportEntry, err error) {
+	if report == nil {
+		return
+	}
+	entry.Outcome = OutcomeFailed
+	entry.Error = err.Error()
+	report.add(entry)
+}
+
+// add keeps one entry for each repository. A failure is not hidden by a later outcome, e.g. already cloned after
+// updating the archived marker failed, and further failures are added to the error.
+func (report *RunReport) add(entry RunReportEntry) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+	key := runReportKey{hostName: entry.HostName, pathWithNamespace: entry.PathWithNamespace, path: entry.Path}
+	index, recordedBefore := report.indexes[key]
+	if !recordedBefore {
+		report.indexes[key] = len(report.entries)
+		report.entries = append(report.entries, entry)
+		return
+	}
+	recorded := &report.entries[index]
+	recorded.Duration += entry.Duration
+	switch {
+	case entry.Outcome != OutcomeFailed:
+		if recorded.Outcome != OutcomeFailed {
+			recorded.Outcome = entry.Outcome
+		}
+	case recorded.Outcome == OutcomeFailed:
+		recorded.Error = recorded.Error + "; " + entry.Error
+	default:
+		recorded.Outcome = OutcomeFailed
+		recorded.Error = entry.Error
+	}
+}
+
+// Entries are ordered by host and working copy path
+func (report *RunReport) Entries() []RunReportEntry {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+	entries := slices.Clone(report.entries)
+	slices.SortFunc(entries, func(a, b RunReportEntry) int {
+		return cmp.Or(cmp.Compare(a.HostName, b.HostName), cmp.Compare(a.Path, b.Path))
+	})
+	return entries
+}
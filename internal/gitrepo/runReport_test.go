@@ -0,0 +1,38 @@
+package gitrepo
+
+import (
+	"errors"
+	"gcm/internal/gitremote"
+	"testing"
+)
+
+func TestRunReport_KeepsFailuresOfARepository(t *testing.T) {
+	report := NewRunReport()
+	repo := CreateFromGitRemoteConfig(
+		gitremote.GitRemoteProjectConfig{Name: "app", FullPath: "team/app"}, "example.com", t.TempDir(), "", nil,
+	)
+
+	report.Record(repo, OutcomeFailed, 0, errors.New("updating the archived marker failed"))
+	report.Record(repo, OutcomeAlreadyCloned, 0, nil)
+	report.Record(repo, OutcomeFailed, 0, errors.New("post-clone setup failed"))
+
+	entries := report.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry for the repository, got %+v", entries)
+	}
+	expectedError := "updating the archived marker failed; post-clone setup failed"
+	if entries[0].Outcome != OutcomeFailed || entries[0].Error != expectedError {
+		t.Errorf("expected the failures to be kept, got %+v", entries[0])
+	}
+}
+
+func TestRunReport_RecordsFailuresWithoutRepository(t *testing.T) {
+	report := NewRunReport()
+
+	report.RecordFailed(RunReportEntry{HostName: "example.com", Name: "team"}, errors.New("failed to fetch projects"))
+
+	entries := report.Entries()
+	if len(entries) != 1 || entries[0].Outcome != OutcomeFailed || entries[0].Error != "failed to fetch projects" {
+		t.Errorf("expected a failed entry, got %+v", entries)
+	}
+}
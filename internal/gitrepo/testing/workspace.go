@@ -0,0 +1,73 @@
+/*
+Package testing sets up working copies on a gitrepo.FakeBackend for command tests.
+Import it as repotesting, next to the standard testing package.
+*/
+package testing
+
+import (
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
+	"testing"
+)
+
+// HostName Host the repositories of a workspace are configured on
+const HostName = "gitlab.example.com"
+
+// DefaultRemote is what Workspace.Clone clones projects from, a main branch with one commit
+var DefaultRemote = gitrepo.FakeRemote{Branches: []string{"main"}, Commits: 1}
+
+// Workspace A clone directory with working copies cloned from an in-memory backend
+type Workspace struct {
+	CloneDirectory string
+	Backend        *gitrepo.FakeBackend
+}
+
+// NewWorkspace is an empty workspace in a temporary directory removed when t ends
+func NewWorkspace(t testing.TB) *Workspace {
+	t.Helper()
+	return &Workspace{CloneDirectory: t.TempDir(), Backend: gitrepo.NewFakeBackend()}
+}
+
+// Repository is project configured on HostName with its working copy in the workspace, not cloned yet
+func (w *Workspace) Repository(project gitremote.GitRemoteProjectConfig) *gitrepo.GitRepository {
+	return gitrepo.CreateFromGitRemoteConfig(project, HostName, w.CloneDirectory, "", w.Backend)
+}
+
+// Clone clones projects from DefaultRemote into the workspace
+func (w *Workspace) Clone(t testing.TB, projects ...gitremote.GitRemoteProjectConfig) []*gitrepo.GitRepository {
+	t.Helper()
+	repos := make([]*gitrepo.GitRepository, 0, len(projects))
+	for _, project := range projects {
+		repos = append(repos, w.Repository(project))
+	}
+	w.CloneFrom(t, DefaultRemote, repos...)
+	return repos
+}
+
+// AddRemotes makes repos cloneable from remote
+func (w *Workspace) AddRemotes(remote gitrepo.FakeRemote, repos ...*gitrepo.GitRepository) {
+	for _, repo := range repos {
+		w.Backend.AddRemote(repo.SSHURLToRepo, remote)
+	}
+}
+
+// CloneFrom clones repos from remote, failing t when a clone fails
+func (w *Workspace) CloneFrom(t testing.TB, remote gitrepo.FakeRemote, repos ...*gitrepo.GitRepository) {
+	t.Helper()
+	w.AddRemotes(remote, repos...)
+	for _, repo := range repos {
+		if err := repo.Clone(); err != nil {
+			t.Fatalf("clone of %s failed: %v", repo.Name, err)
+		}
+	}
+}
+
+// Channel passes repos on in order, like the repository stage of a command
+func Channel(repos ...*gitrepo.GitRepository) <-chan gitrepo.GitRepo {
+	repositories := make(chan gitrepo.GitRepo, len(repos))
+	for _, repo := range repos {
+		repositories <- repo
+	}
+	close(repositories)
+	return repositories
+}
@@ -0,0 +1,110 @@
+package gitrepo
+
+import (
+	"fmt"
+	. "gcm/internal/log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// worktreeSeparator joins the working copy path and the branch in the path of a worktree
+const worktreeSeparator = "@"
+
+// WorktreePath places the worktree of a branch next to the working copy, e.g. project@release-1.0 for release/1.0
+func WorktreePath(workingCopyPath string, branch string) string {
+	return workingCopyPath + worktreeSeparator + strings.ReplaceAll(branch, "/", "-")
+}
+
+// SyncWorktrees adds a worktree for every remote branch matching the configured worktrees and removes worktrees gcm
+// added for branches no longer configured, reporting how many were added and removed
+func (repo *GitRepository) SyncWorktrees() (int, int, error) {
+	projectPath := repo.WorkingCopyPath()
+	configured := repo.CloneOptions.CloneConfig().Worktrees
+	existing, err := filepath.Glob(globEscape(projectPath) + worktreeSeparator + "*")
+	if err != nil || (len(configured) == 0 && len(existing) == 0) {
+		return 0, 0, err
+	}
+
+	wanted, err := repo.wantedWorktrees(projectPath, configured)
+	if err != nil {
+		return 0, 0, err
+	}
+	linked, err := repo.git().Worktrees(projectPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("in %s, listing worktrees failed: %v", projectPath, err)
+	}
+
+	added := 0
+	for worktreePath, branch := range wanted {
+		if _, err := os.Stat(worktreePath); err == nil {
+			continue
+		}
+		Log.Infof("Adding worktree of %s for branch %s in %s", repo.Name, branch, worktreePath)
+		if err := repo.git().AddWorktree(projectPath, worktreePath, branch); err != nil {
+			return added, 0, fmt.Errorf("in %s, adding worktree for %s failed: %v", projectPath, branch, err)
+		}
+		added++
+	}
+
+	removed := 0
+	for _, worktreePath := range existing {
+		if _, ok := wanted[worktreePath]; ok || !isLinkedWorktree(worktreePath, linked) {
+			continue
+		}
+		Log.Infof("Removing worktree %s of %s, its branch is no longer configured", worktreePath, repo.Name)
+		if err := repo.git().RemoveWorktree(projectPath, worktreePath); err != nil {
+			return added, removed, fmt.Errorf("in %s, removing worktree %s failed: %v", projectPath, worktreePath, err)
+		}
+		removed++
+	}
+	return added, removed, nil
+}
+
+// wantedWorktrees maps worktree paths to the remote branches matching configured branch patterns. The branch checked
+// out in the working copy itself cannot have a worktree.
+func (repo *GitRepository) wantedWorktrees(projectPath string, configured []string) (map[string]string, error) {
+	wanted := make(map[string]string)
+	if len(configured) == 0 {
+		return wanted, nil
+	}
+	branches, err := repo.git().RemoteBranches(projectPath, OriginRemote)
+	if err != nil {
+		return nil, fmt.Errorf("in %s, listing remote branches failed: %v", projectPath, err)
+	}
+	status, err := repo.git().Status(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range configured {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid worktree branch pattern %q: %v", pattern, err)
+		}
+		for _, branch := range branches {
+			if matched, _ := path.Match(pattern, branch); matched && branch != status.Branch {
+				wanted[WorktreePath(projectPath, branch)] = branch
+			}
+		}
+	}
+	return wanted, nil
+}
+
+// isLinkedWorktree tells whether worktreePath is one of the linked worktrees, which git reports with resolved symlinks
+func isLinkedWorktree(worktreePath string, linked []string) bool {
+	info, err := os.Stat(worktreePath)
+	if err != nil {
+		return false
+	}
+	for _, linkedPath := range linked {
+		if linkedInfo, err := os.Stat(linkedPath); err == nil && os.SameFile(info, linkedInfo) {
+			return true
+		}
+	}
+	return false
+}
+
+func globEscape(pattern string) string {
+	replacer := strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`)
+	return replacer.Replace(pattern)
+}
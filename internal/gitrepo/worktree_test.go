@@ -0,0 +1,68 @@
+package gitrepo
+
+import (
+	"gcm/internal/gitremote"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSyncWorktrees(t *testing.T) {
+	cloneDirectory := t.TempDir()
+	backend := NewFakeBackend()
+	backend.AddRemote(
+		"git@example.com:team/app",
+		FakeRemote{Branches: []string{"main", "release/1.0", "release/2.0", "feature"}, Commits: 1},
+	)
+	withWorktrees := func(worktrees ...string) *GitRepository {
+		return CreateFromGitRemoteConfig(
+			gitremote.GitRemoteProjectConfig{
+				Name:        "app",
+				FullPath:    "team/app",
+				CloneConfig: gitremote.CloneConfig{Worktrees: worktrees},
+			},
+			"example.com",
+			cloneDirectory,
+			"",
+			backend,
+		)
+	}
+	projectPath := path.Join(cloneDirectory, "team", "app")
+
+	repo := withWorktrees("main", "release/*")
+	if err := repo.Clone(); err != nil {
+		t.Fatalf("clone failed: %v", err)
+	}
+	added, removed, err := repo.SyncWorktrees()
+	if err != nil || added != 2 || removed != 0 {
+		t.Fatalf("expected 2 worktrees added, got %d added, %d removed, %v", added, removed, err)
+	}
+	for _, worktree := range []string{"app@release-1.0", "app@release-2.0"} {
+		if _, err := os.Stat(path.Join(cloneDirectory, "team", worktree)); err != nil {
+			t.Errorf("expected worktree %s: %v", worktree, err)
+		}
+	}
+	if _, err := os.Stat(projectPath + "@main"); !os.IsNotExist(err) {
+		t.Errorf("expected no worktree for the branch checked out in the working copy")
+	}
+
+	added, removed, err = repo.SyncWorktrees()
+	if err != nil || added != 0 || removed != 0 {
+		t.Errorf("expected worktrees to be left alone, got %d added, %d removed, %v", added, removed, err)
+	}
+
+	// Not a worktree of the project, must be left alone
+	if err := os.MkdirAll(projectPath+"@notes", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	added, removed, err = withWorktrees("release/2.0").SyncWorktrees()
+	if err != nil || added != 0 || removed != 1 {
+		t.Errorf("expected 1 worktree removed, got %d added, %d removed, %v", added, removed, err)
+	}
+	if _, err := os.Stat(projectPath + "@release-1.0"); !os.IsNotExist(err) {
+		t.Errorf("expected worktree of release/1.0 to be removed")
+	}
+	if _, err := os.Stat(projectPath + "@notes"); err != nil {
+		t.Errorf("expected unrelated directory to be kept: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package lfsCommand
+
+import (
+	"context"
+	"fmt"
+	"gcm/internal/counter"
+	"gcm/internal/gitrepo"
+	logger "gcm/internal/log"
+	"gcm/internal/view"
+	"os"
+	"time"
+)
+
+type LfsPullCommandViewModel struct {
+	CheckedCount   *counter.Counter
+	PulledCount    *counter.Counter
+	ErrorViewModel *view.ErrorViewModel
+}
+
+func NewLfsPullCommandViewModel() *LfsPullCommandViewModel {
+	return &LfsPullCommandViewModel{
+		CheckedCount:   counter.NewCounter(),
+		PulledCount:    counter.NewCounter(),
+		ErrorViewModel: view.NewErrorViewModel(logger.GetLogFilePath()),
+	}
+}
+
+func NewLfsPullCommandView(vm *LfsPullCommandViewModel) view.View {
+	out := os.Stdout
+	compositeView := view.NewCompositeView([]view.View{
+		view.NewCounterView(
+			out, "%s working copies checked, %s with Git LFS content pulled", vm.CheckedCount, vm.PulledCount,
+		),
+	})
+	compositeView.AddFooter(view.NewErrorView(vm.ErrorViewModel, out))
+	compositeView.AddFooter(view.NewTimeElapsedView(time.Now(), out, time.Since))
+	return compositeView
+}
+
+// ExecuteLfsPullCommand downloads the Git LFS content that was skipped when cloning. When ctx is done no more downloads
+// start, the remaining repositories are drained.
+func ExecuteLfsPullCommand(
+	ctx context.Context,
+	repositories <-chan gitrepo.GitRepo,
+	errorChannel chan error,
+	vm *LfsPullCommandViewModel,
+) {
+	for repo := range repositories {
+		if ctx.Err() != nil {
+			continue
+		}
+		pulled, err := repo.LfsPull()
+		vm.CheckedCount.Add(1)
+		if err != nil {
+			errorChannel <- fmt.Errorf("failed to pull Git LFS content for %s: %v", repo.GetName(), err)
+			continue
+		}
+		if pulled {
+			vm.PulledCount.Add(1)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package lfsCommand
+
+import (
+	"context"
+	"gcm/internal/gitremote"
+	repotesting "gcm/internal/gitrepo/testing"
+	"testing"
+)
+
+func TestExecuteLfsPullCommand(t *testing.T) {
+	workspace := repotesting.NewWorkspace(t)
+	repos := workspace.Clone(
+		t,
+		gitremote.GitRemoteProjectConfig{
+			Name: "assets", FullPath: "team/assets", CloneConfig: gitremote.CloneConfig{SkipLfs: true},
+		},
+		gitremote.GitRemoteProjectConfig{Name: "app", FullPath: "team/app"},
+	)
+	vm := NewLfsPullCommandViewModel()
+	errorChannel := make(chan error, 10)
+
+	ExecuteLfsPullCommand(context.Background(), repotesting.Channel(repos...), errorChannel, vm)
+	close(errorChannel)
+
+	for err := range errorChannel {
+		t.Errorf("unexpected error %v", err)
+	}
+	if checked, pulled := vm.CheckedCount.Count(), vm.PulledCount.Count(); checked != 2 || pulled != 1 {
+		t.Errorf("expected 2 checked and 1 pulled, got %d checked and %d pulled", checked, pulled)
+	}
+	for _, repo := range repos {
+		expected := map[string]int{"assets": 1, "app": 0}[repo.Name]
+		count, err := workspace.Backend.LfsPullCount(repo.WorkingCopyPath())
+		if err != nil || count != expected {
+			t.Errorf("expected Git LFS content of %s pulled %d times, got %d, %v", repo.Name, expected, count, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package remotesCommand
+
+import (
+	"context"
+	"fmt"
+	"gcm/internal/channel"
+	"gcm/internal/color"
+	"gcm/internal/counter"
+	"gcm/internal/ext"
+	"gcm/internal/gitrepo"
+	logger "gcm/internal/log"
+	"gcm/internal/view"
+	"github.com/samber/lo"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Number of working copies checked at the same time, checking is local and quick
+const checkConcurrency = 8
+
+type RemotesCommandViewModel struct {
+	CheckedCount   *counter.Counter
+	DriftedCount   *counter.Counter
+	FixedCount     *counter.Counter
+	ErrorViewModel *view.ErrorViewModel
+}
+
+func NewRemotesCommandViewModel() *RemotesCommandViewModel {
+	return &RemotesCommandViewModel{
+		CheckedCount:   counter.NewCounter(),
+		DriftedCount:   counter.NewCounter(),
+		FixedCount:     counter.NewCounter(),
+		ErrorViewModel: view.NewErrorViewModel(logger.GetLogFilePath()),
+	}
+}
+
+func NewRemotesCommandView(vm *RemotesCommandViewModel) view.View {
+	out := os.Stdout
+	compositeView := view.NewCompositeView([]view.View{
+		view.NewCounterView(
+			out, "%s working copies checked, %s with outdated origin, %s fixed",
+			vm.CheckedCount, vm.DriftedCount, vm.FixedCount,
+		),
+	})
+	compositeView.AddFooter(view.NewErrorView(vm.ErrorViewModel, out))
+	compositeView.AddFooter(view.NewTimeElapsedView(time.Now(), out, time.Since))
+	return compositeView
+}
+
+// Drift A working copy with an origin URL that is not the one the provider reports
+type Drift struct {
+	Repo   gitrepo.GitRepo
+	Origin string
+}
+
+// ExecuteFindDriftCommand compares origin of every cloned repository with the provider, returning drifts ordered by path.
+// When ctx is done no more working copies are checked.
+func ExecuteFindDriftCommand(
+	ctx context.Context,
+	repositories <-chan gitrepo.GitRepo,
+	errorChannel chan error,
+	vm *RemotesCommandViewModel,
+) []Drift {
+	drifts := lo.ChannelToSlice(channel.Parallel(repositories, checkConcurrency, func(repo gitrepo.GitRepo) (Drift, bool) {
+		if ctx.Err() != nil {
+			return Drift{}, false
+		}
+		origin, err := repo.OriginDrift()
+		vm.CheckedCount.Add(1)
+		if err != nil {
+			errorChannel <- fmt.Errorf("failed to check origin of %s: %v", repo.GetName(), err)
+			return Drift{}, false
+		}
+		if origin == "" {
+			return Drift{}, false
+		}
+		vm.DriftedCount.Add(1)
+		return Drift{Repo: repo, Origin: origin}, true
+	}, checkConcurrency))
+	slices.SortFunc(drifts, func(a, b Drift) int {
+		return strings.Compare(a.Repo.WorkingCopyPath(), b.Repo.WorkingCopyPath())
+	})
+	return drifts
+}
+
+// PrintDrifts lists the origin changes that fixing would make
+func PrintDrifts(out io.Writer, drifts []Drift) {
+	for _, drift := range drifts {
+		_, _ = fmt.Fprintf(
+			out, "%s\n    %s -> %s\n",
+			color.FgCyan(ext.ReplaceHomeDirWithTilde(drift.Repo.WorkingCopyPath())),
+			drift.Origin,
+			color.FgMagenta(drift.Repo.GetSSHURLToRepo()),
+		)
+	}
+}
+
+// ExecuteFixDriftCommand points origin of every drifted working copy to the URL the provider reports. When ctx is done
+// the remaining working copies are left alone.
+func ExecuteFixDriftCommand(ctx context.Context, drifts []Drift, errorChannel chan error, vm *RemotesCommandViewModel) {
+	for _, drift := range drifts {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := drift.Repo.FixOrigin(); err != nil {
+			errorChannel <- fmt.Errorf("failed to fix origin of %s: %v", drift.Repo.GetName(), err)
+			continue
+		}
+		vm.FixedCount.Add(1)
+	}
+}
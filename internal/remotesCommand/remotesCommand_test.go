@@ -0,0 +1,55 @@
+package remotesCommand
+
+import (
+	"bytes"
+	"context"
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
+	repotesting "gcm/internal/gitrepo/testing"
+	"strings"
+	"testing"
+)
+
+func TestFindAndFixDrift(t *testing.T) {
+	workspace := repotesting.NewWorkspace(t)
+	repos := workspace.Clone(
+		t,
+		gitremote.GitRemoteProjectConfig{Name: "moved", FullPath: "team/moved"},
+		gitremote.GitRemoteProjectConfig{Name: "app", FullPath: "team/app"},
+		gitremote.GitRemoteProjectConfig{Name: "renamed", FullPath: "team/renamed"},
+	)
+	for _, repo := range []*gitrepo.GitRepository{repos[0], repos[2]} {
+		err := workspace.Backend.SetRemoteURL(repo.WorkingCopyPath(), gitrepo.OriginRemote, "git@old.example.com:"+repo.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	vm := NewRemotesCommandViewModel()
+	errorChannel := make(chan error, 10)
+
+	drifts := ExecuteFindDriftCommand(context.Background(), repotesting.Channel(repos...), errorChannel, vm)
+
+	if len(drifts) != 2 || drifts[0].Repo.GetName() != "moved" || drifts[1].Origin != "git@old.example.com:renamed" {
+		t.Fatalf("expected drifts of moved and renamed ordered by path, got %+v", drifts)
+	}
+	var out bytes.Buffer
+	PrintDrifts(&out, drifts)
+	if !strings.Contains(out.String(), "git@old.example.com:moved") {
+		t.Errorf("expected the outdated origin to be listed, got\n%s", out.String())
+	}
+
+	ExecuteFixDriftCommand(context.Background(), drifts, errorChannel, vm)
+	close(errorChannel)
+
+	for err := range errorChannel {
+		t.Errorf("unexpected error %v", err)
+	}
+	if checked, fixed := vm.CheckedCount.Count(), vm.FixedCount.Count(); checked != 3 || fixed != 2 {
+		t.Errorf("expected 3 checked and 2 fixed, got %d checked and %d fixed", checked, fixed)
+	}
+	for _, repo := range repos {
+		if origin, err := repo.OriginDrift(); err != nil || origin != "" {
+			t.Errorf("expected origin of %s to be fixed, got %q, %v", repo.GetName(), origin, err)
+		}
+	}
+}
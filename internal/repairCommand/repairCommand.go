@@ -0,0 +1,129 @@
+package repairCommand
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"gcm/internal/channel"
+	"gcm/internal/color"
+	"gcm/internal/counter"
+	"gcm/internal/ext"
+	"gcm/internal/gitrepo"
+	logger "gcm/internal/log"
+	"gcm/internal/view"
+	"github.com/samber/lo"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+type RepairCommandViewModel struct {
+	CheckedCount   *counter.Counter
+	ProblemCount   *counter.Counter
+	RepairedCount  *counter.Counter
+	ErrorViewModel *view.ErrorViewModel
+}
+
+func NewRepairCommandViewModel() *RepairCommandViewModel {
+	return &RepairCommandViewModel{
+		CheckedCount:   counter.NewCounter(),
+		ProblemCount:   counter.NewCounter(),
+		RepairedCount:  counter.NewCounter(),
+		ErrorViewModel: view.NewErrorViewModel(logger.GetLogFilePath()),
+	}
+}
+
+func NewRepairCommandView(vm *RepairCommandViewModel) view.View {
+	out := os.Stdout
+	compositeView := view.NewCompositeView([]view.View{
+		view.NewCounterView(
+			out, "%s working copies checked, %s with problems, %s repaired",
+			vm.CheckedCount, vm.ProblemCount, vm.RepairedCount,
+		),
+	})
+	compositeView.AddFooter(view.NewErrorView(vm.ErrorViewModel, out))
+	compositeView.AddFooter(view.NewTimeElapsedView(time.Now(), out, time.Since))
+	return compositeView
+}
+
+// Diagnosis A working copy with a problem
+type Diagnosis struct {
+	Repo    gitrepo.GitRepo
+	Problem gitrepo.Problem
+}
+
+// ExecuteDiagnoseCommand checks every working copy of repositories, returning those with problems ordered by path.
+// When ctx is done no more working copies are checked.
+func ExecuteDiagnoseCommand(
+	ctx context.Context,
+	repositories <-chan gitrepo.GitRepo,
+	errorChannel chan error,
+	vm *RepairCommandViewModel,
+) []Diagnosis {
+	// git fsck is CPU bound
+	workers := runtime.NumCPU()
+	diagnoses := lo.ChannelToSlice(channel.Parallel(repositories, workers, func(repo gitrepo.GitRepo) (Diagnosis, bool) {
+		if ctx.Err() != nil {
+			return Diagnosis{}, false
+		}
+		problem, err := repo.Diagnose()
+		vm.CheckedCount.Add(1)
+		if err != nil {
+			errorChannel <- fmt.Errorf("failed to check working copy of %s: %v", repo.GetName(), err)
+			return Diagnosis{}, false
+		}
+		if problem == nil {
+			return Diagnosis{}, false
+		}
+		vm.ProblemCount.Add(1)
+		return Diagnosis{Repo: repo, Problem: *problem}, true
+	}, workers))
+	slices.SortFunc(diagnoses, func(a, b Diagnosis) int {
+		return strings.Compare(a.Repo.WorkingCopyPath(), b.Repo.WorkingCopyPath())
+	})
+	return diagnoses
+}
+
+// PrintDiagnoses lists problems and how they would be fixed
+func PrintDiagnoses(out io.Writer, diagnoses []Diagnosis) {
+	for _, diagnosis := range diagnoses {
+		_, _ = fmt.Fprintf(
+			out, "%s\n    %s -> %s\n",
+			color.FgCyan(ext.ReplaceHomeDirWithTilde(diagnosis.Repo.WorkingCopyPath())),
+			diagnosis.Problem,
+			color.FgMagenta(diagnosis.Problem.Fix()),
+		)
+	}
+}
+
+// ConfirmRepair asks whether to repair, anything but yes is a no
+func ConfirmRepair(in io.Reader, out io.Writer, diagnoses []Diagnosis) bool {
+	_, _ = fmt.Fprintf(out, "Repair %d working copies? [y/N] ", len(diagnoses))
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// ExecuteRepairCommand fixes diagnosed problems one working copy at a time. When ctx is done the remaining working
+// copies are left alone.
+func ExecuteRepairCommand(
+	ctx context.Context,
+	diagnoses []Diagnosis,
+	errorChannel chan error,
+	vm *RepairCommandViewModel,
+) {
+	for _, diagnosis := range diagnoses {
+		if ctx.Err() != nil {
+			return
+		}
+		err := diagnosis.Repo.Repair(diagnosis.Problem)
+		if err != nil {
+			errorChannel <- fmt.Errorf("failed to repair %s: %v", diagnosis.Repo.GetName(), err)
+			continue
+		}
+		vm.RepairedCount.Add(1)
+	}
+}
@@ -0,0 +1,85 @@
+package repairCommand
+
+import (
+	"bytes"
+	"context"
+	"gcm/internal/gitlab"
+	"gcm/internal/gitremote"
+	"gcm/internal/gitrepo"
+	repotesting "gcm/internal/gitrepo/testing"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestDiagnoseAndRepair(t *testing.T) {
+	workspace := repotesting.NewWorkspace(t)
+	gitLabConfig := &gitlab.GitLabConfig{
+		HostName:       repotesting.HostName,
+		CloneDirectory: workspace.CloneDirectory,
+		Groups:         []gitlab.GroupConfig{{Name: "legacy"}},
+		Projects: []gitremote.GitRemoteProjectConfig{
+			{
+				Name:     "app",
+				FullPath: "team/app",
+				CloneConfig: gitremote.CloneConfig{
+					PostClone: gitremote.PostCloneConfig{GitConfig: map[string]string{"user.email": "dev@example.com"}},
+					Worktrees: []string{"release/*"},
+				},
+			},
+		},
+	}
+	backend := workspace.Backend
+	app := gitLabConfig.ConfiguredRepository(gitlab.Project{Name: "app", PathWithNamespace: "team/app"}, backend)
+	// Archived while cloneArchived is off, clone would leave it alone
+	archived := gitLabConfig.ConfiguredRepository(gitlab.Project{
+		Name:              "old",
+		PathWithNamespace: "legacy/old",
+		SSHURLToRepo:      "git@gitlab.example.com:legacy/old",
+		Archived:          true,
+	}, backend)
+	workspace.AddRemotes(gitrepo.FakeRemote{Branches: []string{"main", "release/1.0"}, Commits: 2}, app, archived)
+	for _, repo := range []*gitrepo.GitRepository{app, archived} {
+		if err := os.MkdirAll(repo.WorkingCopyPath(), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vm := NewRepairCommandViewModel()
+	errorChannel := make(chan error, 10)
+
+	diagnoses := ExecuteDiagnoseCommand(context.Background(), repotesting.Channel(app, archived), errorChannel, vm)
+
+	if len(diagnoses) != 2 || diagnoses[0].Repo != archived || diagnoses[1].Problem.Kind != gitrepo.MissingGitDirectory {
+		t.Fatalf("expected both working copies without .git ordered by path, got %+v", diagnoses)
+	}
+	var out bytes.Buffer
+	PrintDiagnoses(&out, diagnoses)
+	if !strings.Contains(out.String(), "no .git directory -> re-clone") {
+		t.Errorf("expected the problem and its fix to be listed, got\n%s", out.String())
+	}
+
+	ExecuteRepairCommand(context.Background(), diagnoses, errorChannel, vm)
+	close(errorChannel)
+
+	for err := range errorChannel {
+		t.Errorf("unexpected error %v", err)
+	}
+	if repaired := vm.RepairedCount.Count(); repaired != 2 {
+		t.Errorf("expected 2 repaired, got %d", repaired)
+	}
+	for _, repo := range []*gitrepo.GitRepository{app, archived} {
+		if cloned, err := repo.IsCloned(); err != nil || !cloned {
+			t.Errorf("expected %s to be cloned again, got %v, %v", repo.Name, cloned, err)
+		}
+	}
+	if _, err := os.Stat(path.Join(archived.WorkingCopyPath(), gitrepo.ArchivedMarkerFileName)); err != nil {
+		t.Errorf("expected the archived marker in the repaired working copy: %v", err)
+	}
+	if email, err := backend.ConfigValue(app.WorkingCopyPath(), "user.email"); err != nil || email != "dev@example.com" {
+		t.Errorf("expected post-clone git config to be set, got %q, %v", email, err)
+	}
+	if _, err := os.Stat(app.WorkingCopyPath() + "@release-1.0"); err != nil {
+		t.Errorf("expected the worktree to be added again: %v", err)
+	}
+}
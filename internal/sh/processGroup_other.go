@@ -0,0 +1,9 @@
+//go:build !unix
+
+package sh
+
+import "os/exec"
+
+// startProcessGroup leaves cmd in the process group of gcm, cancelling kills only cmd itself
+func startProcessGroup(*exec.Cmd) {
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package sh
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startProcessGroup starts cmd in a new process group, and makes cancelling kill the whole group,
+// e.g. the ssh process started by git along with git
+func startProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -1,9 +1,13 @@
 package sh
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 type DirectoryPath string
@@ -19,3 +23,32 @@ func ExecuteShellCommand(cwd DirectoryPath, command ShellCommand) (string, error
 	}
 	return strings.TrimSpace(string(out)), nil
 }
+
+// ExecuteCommand runs a program directly, without a shell, so arguments need no quoting.
+// On failure the returned error includes what the program wrote to stderr.
+func ExecuteCommand(cwd DirectoryPath, name string, args ...string) (string, error) {
+	return ExecuteCommandContext(context.Background(), cwd, name, args...)
+}
+
+// ExecuteCommandContext runs a program like ExecuteCommand, killing it with everything it started when ctx is done.
+// The program runs in a process group of its own, so Ctrl-C in the terminal does not reach it and gcm decides when
+// to stop it.
+func ExecuteCommandContext(ctx context.Context, cwd DirectoryPath, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	startProcessGroup(cmd)
+	// Children left running after a kill could keep the output pipes open
+	cmd.WaitDelay = time.Second
+	cmd.Dir = string(cwd)
+	cmd.Env = os.Environ()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %s", err, message)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
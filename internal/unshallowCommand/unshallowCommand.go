@@ -0,0 +1,62 @@
+package unshallowCommand
+
+import (
+	"context"
+	"fmt"
+	"gcm/internal/counter"
+	"gcm/internal/gitrepo"
+	logger "gcm/internal/log"
+	"gcm/internal/view"
+	"os"
+	"time"
+)
+
+type UnshallowCommandViewModel struct {
+	CheckedCount   *counter.Counter
+	ConvertedCount *counter.Counter
+	ErrorViewModel *view.ErrorViewModel
+}
+
+func NewUnshallowCommandViewModel() *UnshallowCommandViewModel {
+	return &UnshallowCommandViewModel{
+		CheckedCount:   counter.NewCounter(),
+		ConvertedCount: counter.NewCounter(),
+		ErrorViewModel: view.NewErrorViewModel(logger.GetLogFilePath()),
+	}
+}
+
+func NewUnshallowCommandView(vm *UnshallowCommandViewModel) view.View {
+	out := os.Stdout
+	compositeView := view.NewCompositeView([]view.View{
+		view.NewCounterView(
+			out, "%s working copies checked, %s converted to full clones", vm.CheckedCount, vm.ConvertedCount,
+		),
+	})
+	compositeView.AddFooter(view.NewErrorView(vm.ErrorViewModel, out))
+	compositeView.AddFooter(view.NewTimeElapsedView(time.Now(), out, time.Since))
+	return compositeView
+}
+
+// ExecuteUnshallowCommand fetches the history and objects left out by shallow, partial and single branch clones. When
+// ctx is done no more fetches start, the remaining repositories are drained.
+func ExecuteUnshallowCommand(
+	ctx context.Context,
+	repositories <-chan gitrepo.GitRepo,
+	errorChannel chan error,
+	vm *UnshallowCommandViewModel,
+) {
+	for repo := range repositories {
+		if ctx.Err() != nil {
+			continue
+		}
+		converted, err := repo.MakeComplete()
+		vm.CheckedCount.Add(1)
+		if err != nil {
+			errorChannel <- fmt.Errorf("failed to convert %s to a full clone: %v", repo.GetName(), err)
+			continue
+		}
+		if converted {
+			vm.ConvertedCount.Add(1)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package unshallowCommand
+
+import (
+	"context"
+	"gcm/internal/gitremote"
+	repotesting "gcm/internal/gitrepo/testing"
+	"testing"
+)
+
+func TestExecuteUnshallowCommand(t *testing.T) {
+	workspace := repotesting.NewWorkspace(t)
+	repos := workspace.Clone(
+		t,
+		gitremote.GitRemoteProjectConfig{
+			Name: "shallow", FullPath: "team/shallow", CloneConfig: gitremote.CloneConfig{Depth: 1},
+		},
+		gitremote.GitRemoteProjectConfig{
+			Name: "partial", FullPath: "team/partial", CloneConfig: gitremote.CloneConfig{Filter: "blob:none"},
+		},
+		gitremote.GitRemoteProjectConfig{Name: "full", FullPath: "team/full"},
+	)
+	vm := NewUnshallowCommandViewModel()
+	errorChannel := make(chan error, 10)
+
+	ExecuteUnshallowCommand(context.Background(), repotesting.Channel(repos...), errorChannel, vm)
+	close(errorChannel)
+
+	for err := range errorChannel {
+		t.Errorf("unexpected error %v", err)
+	}
+	if checked, converted := vm.CheckedCount.Count(), vm.ConvertedCount.Count(); checked != 3 || converted != 2 {
+		t.Errorf("expected 3 checked and 2 converted, got %d checked and %d converted", checked, converted)
+	}
+	for _, repo := range repos {
+		completeness, err := workspace.Backend.Completeness(repo.WorkingCopyPath())
+		if err != nil || !completeness.IsComplete() {
+			t.Errorf("expected %s to be a full clone, got %+v, %v", repo.Name, completeness, err)
+		}
+	}
+}
+
+func TestExecuteUnshallowCommand_ConvertsNothingOnceCancelled(t *testing.T) {
+	workspace := repotesting.NewWorkspace(t)
+	repos := workspace.Clone(t, gitremote.GitRemoteProjectConfig{
+		Name: "shallow", FullPath: "team/shallow", CloneConfig: gitremote.CloneConfig{Depth: 1},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	vm := NewUnshallowCommandViewModel()
+
+	ExecuteUnshallowCommand(ctx, repotesting.Channel(repos...), make(chan error, 10), vm)
+
+	completeness, err := workspace.Backend.Completeness(repos[0].WorkingCopyPath())
+	if err != nil || completeness.IsComplete() || vm.ConvertedCount.Count() != 0 {
+		t.Errorf("expected the shallow clone to be left alone, got %+v, %v", completeness, err)
+	}
+}
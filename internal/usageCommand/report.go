@@ -0,0 +1,176 @@
+package usageCommand
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"gcm/internal/gitrepo"
+	"gcm/internal/view"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	HostNode    = "host"
+	GroupNode   = "group"
+	ProjectNode = "project"
+)
+
+// SortKeys What a report can be sorted by. Sizes sort largest first, names alphabetically.
+var SortKeys = []string{"total", "worktree", "objects", "lfs", "name"}
+
+// UsageNode Disk usage of a host, a group with everything below it, or a single project
+type UsageNode struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Path string `json:"path"` // Path with namespace, empty for hosts
+	gitrepo.DiskUsage
+	TotalBytes int64        `json:"totalBytes"`
+	Children   []*UsageNode `json:"children,omitempty"`
+}
+
+// Report Disk usage of working copies, aggregated along the GitLab group hierarchy of every host
+type Report struct {
+	Hosts []*UsageNode
+	nodes map[string]*UsageNode
+}
+
+func NewReport() *Report {
+	return &Report{nodes: make(map[string]*UsageNode)}
+}
+
+// Add adds the disk usage of a project to the project, the GitLab group it was found in with all parent groups, and
+// its host. Projects not found in a group, like projects configured directly, are right below their host.
+func (r *Report) Add(repo gitrepo.GitRepo, usage gitrepo.DiskUsage) {
+	hostName := repo.GetHostName()
+	parent := r.node(hostName, HostNode, hostName, "", nil)
+	parent.add(usage)
+	if groupPath := repo.GetGroupPath(); groupPath != "" {
+		groupNames := strings.Split(groupPath, "/")
+		for i := range groupNames {
+			nodePath := strings.Join(groupNames[:i+1], "/")
+			parent = r.node(hostName+":"+nodePath, GroupNode, groupNames[i], nodePath, parent)
+			parent.add(usage)
+		}
+	}
+	pathWithNamespace := repo.GetPathWithNamespace()
+	project := r.node(hostName+":"+pathWithNamespace, ProjectNode, repo.GetName(), pathWithNamespace, parent)
+	project.add(usage)
+}
+
+func (r *Report) node(key string, kind string, name string, nodePath string, parent *UsageNode) *UsageNode {
+	if node, ok := r.nodes[key]; ok {
+		return node
+	}
+	node := &UsageNode{Kind: kind, Name: name, Path: nodePath}
+	r.nodes[key] = node
+	if parent == nil {
+		r.Hosts = append(r.Hosts, node)
+	} else {
+		parent.Children = append(parent.Children, node)
+	}
+	return node
+}
+
+func (n *UsageNode) add(usage gitrepo.DiskUsage) {
+	n.DiskUsage.Add(usage)
+	n.TotalBytes = n.DiskUsage.Total()
+}
+
+// Sort orders hosts and the children of every group by one of SortKeys
+func (r *Report) Sort(key string) error {
+	if !slices.Contains(SortKeys, key) {
+		return fmt.Errorf("unknown sort key %q, use one of %s", key, strings.Join(SortKeys, ", "))
+	}
+	sortNodes(r.Hosts, key)
+	return nil
+}
+
+func sortNodes(nodes []*UsageNode, key string) {
+	slices.SortFunc(nodes, func(a, b *UsageNode) int {
+		var bySize int
+		switch key {
+		case "total":
+			bySize = cmp.Compare(b.TotalBytes, a.TotalBytes)
+		case "worktree":
+			bySize = cmp.Compare(b.WorkingTree, a.WorkingTree)
+		case "objects":
+			bySize = cmp.Compare(b.Objects, a.Objects)
+		case "lfs":
+			bySize = cmp.Compare(b.Lfs, a.Lfs)
+		}
+		return cmp.Or(bySize, cmp.Compare(a.Name, b.Name))
+	})
+	for _, node := range nodes {
+		sortNodes(node.Children, key)
+	}
+}
+
+// WriteTable writes the report as an indented tree with human readable sizes
+func (r *Report) WriteTable(out io.Writer) error {
+	width := len("PATH")
+	r.walk(func(node *UsageNode, depth int) {
+		width = max(width, 2*depth+len(node.Name))
+	})
+	format := fmt.Sprintf("%%-%ds %%10s %%12s %%10s %%10s\n", width)
+	_, err := fmt.Fprintf(out, format, "PATH", "TOTAL", "WORKING TREE", "OBJECTS", "LFS")
+	r.walk(func(node *UsageNode, depth int) {
+		if err == nil {
+			_, err = fmt.Fprintf(
+				out, format,
+				strings.Repeat("  ", depth)+node.Name,
+				view.FormatBytes(node.TotalBytes),
+				view.FormatBytes(node.WorkingTree),
+				view.FormatBytes(node.Objects),
+				view.FormatBytes(node.Lfs),
+			)
+		}
+	})
+	return err
+}
+
+// WriteJSON writes the report as a tree of hosts, groups and projects with sizes in bytes
+func (r *Report) WriteJSON(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Hosts []*UsageNode `json:"hosts"`
+	}{Hosts: r.Hosts})
+}
+
+// WriteCSV writes one row per host, group and project with sizes in bytes, parents before their children
+func (r *Report) WriteCSV(out io.Writer) error {
+	writer := csv.NewWriter(out)
+	_ = writer.Write([]string{"kind", "host", "path", "totalBytes", "workingTreeBytes", "objectsBytes", "lfsBytes"})
+	for _, host := range r.Hosts {
+		walkNodes(host, 0, func(node *UsageNode, _ int) {
+			_ = writer.Write([]string{
+				node.Kind,
+				host.Name,
+				node.Path,
+				strconv.FormatInt(node.TotalBytes, 10),
+				strconv.FormatInt(node.WorkingTree, 10),
+				strconv.FormatInt(node.Objects, 10),
+				strconv.FormatInt(node.Lfs, 10),
+			})
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (r *Report) walk(visit func(node *UsageNode, depth int)) {
+	for _, host := range r.Hosts {
+		walkNodes(host, 0, visit)
+	}
+}
+
+func walkNodes(node *UsageNode, depth int, visit func(node *UsageNode, depth int)) {
+	visit(node, depth)
+	for _, child := range node.Children {
+		walkNodes(child, depth+1, visit)
+	}
+}
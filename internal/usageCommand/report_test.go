@@ -0,0 +1,54 @@
+package usageCommand
+
+import (
+	"gcm/internal/gitrepo"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	project := func(groupPath string, pathWithNamespace string) gitrepo.GitRepo {
+		return &gitrepo.GitRepository{
+			HostName:          "gitlab.com",
+			GroupPath:         groupPath,
+			Name:              path.Base(pathWithNamespace),
+			PathWithNamespace: pathWithNamespace,
+		}
+	}
+	report := NewReport()
+	report.Add(project("team/backend", "team/backend/api"), gitrepo.DiskUsage{WorkingTree: 100, Objects: 200})
+	report.Add(project("team/backend", "team/backend/worker"), gitrepo.DiskUsage{WorkingTree: 10, Objects: 20, Lfs: 500})
+	report.Add(project("team", "team/web"), gitrepo.DiskUsage{WorkingTree: 50, Objects: 50})
+	// Configured directly, GitLab was not asked for its group
+	report.Add(project("", "other/tool"), gitrepo.DiskUsage{WorkingTree: 5})
+
+	var out strings.Builder
+	if err := WriteReport(&out, report, "total", "csv"); err != nil {
+		t.Fatal(err)
+	}
+	expected := `kind,host,path,totalBytes,workingTreeBytes,objectsBytes,lfsBytes
+host,gitlab.com,,935,165,270,500
+group,gitlab.com,team,930,160,270,500
+group,gitlab.com,team/backend,830,110,220,500
+project,gitlab.com,team/backend/worker,530,10,20,500
+project,gitlab.com,team/backend/api,300,100,200,0
+project,gitlab.com,team/web,100,50,50,0
+project,gitlab.com,other/tool,5,5,0,0
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	if err := WriteReport(&out, report, "name", "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "team/backend/api,300,100,200,0\nproject,gitlab.com,team/backend/worker") {
+		t.Errorf("expected projects sorted by name, got\n%s", out.String())
+	}
+
+	if err := WriteReport(&out, report, "size", "csv"); err == nil {
+		t.Errorf("expected unknown sort key to fail")
+	}
+}
@@ -0,0 +1,91 @@
+package usageCommand
+
+import (
+	"context"
+	"fmt"
+	"gcm/internal/channel"
+	"gcm/internal/counter"
+	"gcm/internal/gitrepo"
+	logger "gcm/internal/log"
+	"gcm/internal/view"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Formats the report can be written in
+var Formats = []string{"table", "json", "csv"}
+
+// Number of working copies measured at the same time, measuring is bound by the disk
+const measureConcurrency = 8
+
+type UsageCommandViewModel struct {
+	MeasuredCount  *counter.Counter
+	ErrorViewModel *view.ErrorViewModel
+}
+
+func NewUsageCommandViewModel() *UsageCommandViewModel {
+	return &UsageCommandViewModel{
+		MeasuredCount:  counter.NewCounter(),
+		ErrorViewModel: view.NewErrorViewModel(logger.GetLogFilePath()),
+	}
+}
+
+func NewUsageCommandView(vm *UsageCommandViewModel) view.View {
+	out := os.Stdout
+	compositeView := view.NewCompositeView([]view.View{
+		view.NewCounterView(out, "%s working copies measured", vm.MeasuredCount),
+	})
+	compositeView.AddFooter(view.NewErrorView(vm.ErrorViewModel, out))
+	compositeView.AddFooter(view.NewTimeElapsedView(time.Now(), out, time.Since))
+	return compositeView
+}
+
+// ExecuteUsageCommand measures the disk usage of every working copy of repositories. When ctx is done no more working
+// copies are measured, the report holds those measured so far.
+func ExecuteUsageCommand(
+	ctx context.Context,
+	repositories <-chan gitrepo.GitRepo,
+	errorChannel chan error,
+	vm *UsageCommandViewModel,
+) *Report {
+	type measured struct {
+		repo  gitrepo.GitRepo
+		usage gitrepo.DiskUsage
+	}
+	measurements := channel.Parallel(repositories, measureConcurrency, func(repo gitrepo.GitRepo) (measured, bool) {
+		if ctx.Err() != nil {
+			return measured{}, false
+		}
+		usage, err := repo.DiskUsage()
+		if err != nil {
+			errorChannel <- fmt.Errorf("failed to measure working copy of %s: %v", repo.GetName(), err)
+			return measured{}, false
+		}
+		vm.MeasuredCount.Add(1)
+		return measured{repo: repo, usage: usage}, true
+	}, measureConcurrency)
+
+	report := NewReport()
+	for measurement := range measurements {
+		report.Add(measurement.repo, measurement.usage)
+	}
+	return report
+}
+
+// WriteReport writes the report sorted by sortKey in one of Formats
+func WriteReport(out io.Writer, report *Report, sortKey string, format string) error {
+	if err := report.Sort(sortKey); err != nil {
+		return err
+	}
+	switch format {
+	case "table":
+		return report.WriteTable(out)
+	case "json":
+		return report.WriteJSON(out)
+	case "csv":
+		return report.WriteCSV(out)
+	}
+	return fmt.Errorf("unknown format %q, use one of %s", format, strings.Join(Formats, ", "))
+}
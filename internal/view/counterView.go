@@ -0,0 +1,37 @@
+package view
+
+import (
+	"fmt"
+	"gcm/internal/color"
+	"gcm/internal/counter"
+	"io"
+	"strings"
+)
+
+// CounterView renders a line of text with the current value of counters filled in for its %s verbs
+type CounterView struct {
+	format   string
+	counters []*counter.Counter
+	stdout   io.Writer
+}
+
+func NewCounterView(stdout io.Writer, format string, counters ...*counter.Counter) *CounterView {
+	return &CounterView{
+		format:   format,
+		counters: counters,
+		stdout:   stdout,
+	}
+}
+
+func (v *CounterView) Render(int) int {
+	values := make([]any, len(v.counters))
+	for i, c := range v.counters {
+		values[i] = color.FgMagenta(fmt.Sprintf("%d", c.Count()))
+	}
+	out := fmt.Sprintf(v.format, values...) + "\n"
+	_, err := fmt.Fprint(v.stdout, out)
+	if err != nil {
+		return 0
+	}
+	return strings.Count(out, "\n")
+}
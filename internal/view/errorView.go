@@ -8,7 +8,9 @@ import (
 	"gcm/internal/ext"
 	logger "gcm/internal/log"
 	"io"
+	"slices"
 	"strings"
+	"sync"
 )
 
 type ErrorViewModel struct {
@@ -16,6 +18,18 @@ type ErrorViewModel struct {
 	latestError  string
 	ErrorChannel chan error
 	logFilePath  string
+	errorsMutex  sync.Mutex
+	errors       []error
+	onError      func(error)
+}
+
+// flushRequest is sent on the error channel by Flush, it is answered once all errors sent before are handled
+type flushRequest struct {
+	done chan struct{}
+}
+
+func (flushRequest) Error() string {
+	return "flush"
 }
 
 func NewErrorViewModel(logFilePath string) *ErrorViewModel {
@@ -26,14 +40,47 @@ func NewErrorViewModel(logFilePath string) *ErrorViewModel {
 	}
 	go func() {
 		for err := range viewModel.ErrorChannel {
+			if flush, ok := err.(flushRequest); ok {
+				close(flush.done)
+				continue
+			}
 			viewModel.errorCount.Add(1)
 			viewModel.latestError = err.Error()
 			logger.Log.Errorf("%v", err)
+			viewModel.errorsMutex.Lock()
+			viewModel.errors = append(viewModel.errors, err)
+			onError := viewModel.onError
+			viewModel.errorsMutex.Unlock()
+			if onError != nil {
+				onError(err)
+			}
 		}
 	}()
 	return &viewModel
 }
 
+// OnError calls handle for every error handled from now on, e.g. to stop at the first one
+func (vm *ErrorViewModel) OnError(handle func(error)) {
+	vm.errorsMutex.Lock()
+	defer vm.errorsMutex.Unlock()
+	vm.onError = handle
+}
+
+// Errors are all errors sent to ErrorChannel before the call
+func (vm *ErrorViewModel) Errors() []error {
+	vm.flush()
+	vm.errorsMutex.Lock()
+	defer vm.errorsMutex.Unlock()
+	return slices.Clone(vm.errors)
+}
+
+// flush waits until every error sent to ErrorChannel so far has been handled
+func (vm *ErrorViewModel) flush() {
+	done := make(chan struct{})
+	vm.ErrorChannel <- flushRequest{done: done}
+	<-done
+}
+
 type ErrorView struct {
 	viewModel *ErrorViewModel
 	stdout    io.Writer
@@ -33,3 +33,24 @@ func TestErrorView_Render(t *testing.T) {
 			"     got %q", expectedOutput, buf.String())
 	}
 }
+
+func TestErrorViewModel_Errors(t *testing.T) {
+	vm := NewErrorViewModel("somePath.log")
+	var handled []error
+	vm.OnError(func(err error) {
+		handled = append(handled, err)
+	})
+	for i := range 25 {
+		vm.ErrorChannel <- fmt.Errorf("error %d", i)
+	}
+
+	// Errors waits for every error sent before to be handled
+	errs := vm.Errors()
+
+	if len(errs) != 25 || errs[24].Error() != "error 24" {
+		t.Errorf("expected 25 errors in order, got %v", errs)
+	}
+	if len(handled) != 25 {
+		t.Errorf("expected OnError to be called for 25 errors, got %d", len(handled))
+	}
+}
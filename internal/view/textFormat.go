@@ -36,3 +36,17 @@ func TrimTextToWidth(width int, out string) string {
 	out = strings.Join(lines, "\n")
 	return out
 }
+
+// FormatBytes Formats a byte count with a binary unit, e.g. 1.5 MiB
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	divisor, exponent := int64(unit), 0
+	for n := bytes / unit; n >= unit && exponent < 5; n /= unit {
+		divisor *= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(divisor), "KMGTPE"[exponent])
+}
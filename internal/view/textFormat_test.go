@@ -52,3 +52,22 @@ func TestTruncateTextToWidth(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes    int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536 * 1024, "1.5 MiB"},
+		{5 * 1024 * 1024 * 1024, "5.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		if result := FormatBytes(tt.bytes); result != tt.expected {
+			t.Errorf("expected %d bytes formatted as %q, got %q", tt.bytes, tt.expected, result)
+		}
+	}
+}
@@ -26,7 +26,11 @@ func StartTTYRenderLoop(r View, out io.Writer, ctx context.Context, file *os.Fil
 		}
 		select {
 		case <-ctx.Done():
-			return // Exit the Render loop when the context is canceled
+			// Render the final state once more so the last counts are not lost when the loop stops
+			if _, err := fmt.Fprint(out, ansiLineOffset(lineCount)); err == nil {
+				r.Render(width)
+			}
+			return
 		default:
 			_, err := fmt.Fprint(out, ansiLineOffset(lineCount))
 			if err != nil {
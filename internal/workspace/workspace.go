@@ -0,0 +1,78 @@
+/*
+Package workspace finds the repositories gcm manages for commands that work on existing working copies.
+*/
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"gcm/internal/appConfig"
+	"gcm/internal/counter"
+	"gcm/internal/gitlab"
+	"gcm/internal/gitrepo"
+	"github.com/samber/lo"
+)
+
+// Repositories channels every repository configured for every host, cloned or not
+func Repositories(
+	ctx context.Context,
+	config *appConfig.AppConfig,
+	backend gitrepo.Backend,
+	errorChannel chan error,
+) <-chan gitrepo.GitRepo {
+	var repoChannels []<-chan gitrepo.GitRepo
+	for _, gitLabConfig := range config.GitLab {
+		repoChannels = append(repoChannels, HostRepositories(ctx, gitLabConfig, backend, errorChannel))
+	}
+	return lo.FanIn(appConfig.DefaultChannelBufferLength, repoChannels...)
+}
+
+// HostRepositories channels every repository configured for one host, cloned or not
+func HostRepositories(
+	ctx context.Context,
+	gitLabConfig gitlab.GitLabConfig,
+	backend gitrepo.Backend,
+	errorChannel chan error,
+) <-chan gitrepo.GitRepo {
+	token := gitLabConfig.RetrieveTokenFromEnv()
+	if token == "" {
+		errorChannel <- gitLabConfig.MissingTokenError()
+		emptyChannel := make(chan gitrepo.GitRepo)
+		close(emptyChannel)
+		return emptyChannel
+	}
+	labApi := gitlab.NewAPIClient(token, gitLabConfig)
+	channeledApi := gitlab.NewChanneledApi(
+		ctx, labApi, &gitLabConfig, counter.NewCounter(), counter.NewCounter(), nil, errorChannel,
+	)
+	return channeledApi.ScheduleRepositories(counter.NewCounter(), backend)
+}
+
+// ClonedRepositories channels the configured repositories that have a working copy
+func ClonedRepositories(
+	ctx context.Context,
+	config *appConfig.AppConfig,
+	backend gitrepo.Backend,
+	errorChannel chan error,
+) <-chan gitrepo.GitRepo {
+	return Cloned(Repositories(ctx, config, backend, errorChannel), errorChannel)
+}
+
+// Cloned passes on the repositories that have a working copy
+func Cloned(repositories <-chan gitrepo.GitRepo, errorChannel chan error) <-chan gitrepo.GitRepo {
+	clonedChannel := make(chan gitrepo.GitRepo, appConfig.DefaultChannelBufferLength)
+	go func() {
+		for repo := range repositories {
+			cloned, err := repo.IsCloned()
+			if err != nil {
+				errorChannel <- fmt.Errorf("error checking clone status %s: %v", repo.GetName(), err)
+				continue
+			}
+			if cloned {
+				clonedChannel <- repo
+			}
+		}
+		close(clonedChannel)
+	}()
+	return clonedChannel
+}
@@ -2,20 +2,49 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"gcm/internal/appConfig"
+	"gcm/internal/bundleCommand"
 	"gcm/internal/cloneCommand"
 	"gcm/internal/cloneCommand/terminalView"
+	"gcm/internal/fetchCommand"
+	"gcm/internal/gitlab"
+	"gcm/internal/gitrepo"
+	"gcm/internal/lfsCommand"
 	. "gcm/internal/log"
+	"gcm/internal/remotesCommand"
+	"gcm/internal/repairCommand"
+	"gcm/internal/unshallowCommand"
+	"gcm/internal/usageCommand"
 	"gcm/internal/view"
+	"gcm/internal/workspace"
 	typex "gcm/type"
 	"golang.org/x/term"
 	"gopkg.in/yaml.v2"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// Exit codes
+const (
+	exitSuccess     = 0
+	exitFailure     = 1 // Some repositories or files could not be processed
+	exitConfigError = 2 // Invalid configuration or command line, nothing was done
+	exitAuthError   = 3 // A GitLab host was skipped for a missing token or refused the token
+	exitInterrupted = 130
+)
+
+// shutdownGracePeriod is how long running git processes may take to finish after an interrupt before they are killed
+const shutdownGracePeriod = 10 * time.Second
+
 func main() {
 
 	//f, _ := os.Create("trace.out")
@@ -26,34 +55,418 @@ func main() {
 	// Process parameters
 	var verbose = typex.NullableBool{}
 	flag.Var(&verbose, "verbose", "Print verbose output")
+	failFast := flag.Bool("fail-fast", false, failFastUsage)
 	flag.Parse()
 	InitLogger(verbose.Val(false))
 
 	config, err := loadConfig("workingCopies.yaml")
+	if err == nil {
+		err = config.Validate()
+	}
 
 	if err != nil {
-		Log.Fatalf("Failed to load configuration: %v", err)
-		os.Exit(1)
+		Log.Errorf("Failed to load configuration: %v", err)
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+	interruptCtx, killCtx := interruptContexts()
+	ctx, abort := context.WithCancel(interruptCtx)
+	defer abort()
+	backend := gitrepo.NewCliBackendWithContext(killCtx)
+
+	// The errors of the command decide the exit code, with -fail-fast the first one stops it
+	var errorViewModel *view.ErrorViewModel
+	watchErrors := func(vm *view.ErrorViewModel) {
+		errorViewModel = vm
+		if *failFast {
+			vm.OnError(func(err error) {
+				Log.Warnf("Stopping after the first error: %v", err)
+				abort()
+			})
+		}
+	}
+
+	switch command := flag.Arg(0); command {
+	case "", "clone":
+		cloneFlags := flag.NewFlagSet("clone", flag.ExitOnError)
+		dryRun := cloneFlags.Bool("dry-run", false, "List what would be cloned and why other repositories are skipped")
+		reportFlags := addRunReportFlags(cloneFlags)
+		addFailFastFlag(cloneFlags, failFast)
+		if flag.NArg() > 0 {
+			_ = cloneFlags.Parse(flag.Args()[1:])
+		}
+		cloneCommandViewModel := terminalView.NewCloneCommandViewModel()
+		watchErrors(cloneCommandViewModel.ErrorViewModel)
+		if *dryRun {
+			var plan []gitrepo.ClonePlanEntry
+			renderWhile(terminalView.NewClonePlanView(cloneCommandViewModel), func() {
+				plan = cloneCommand.ExecuteClonePlanCommand(
+					ctx, config, backend, cloneCommandViewModel.ErrorViewModel.ErrorChannel, cloneCommandViewModel,
+				)
+			})
+			cloneCommand.PrintClonePlan(os.Stdout, plan)
+			break
+		}
+		renderWhile(terminalView.NewCloneCommandView(cloneCommandViewModel), func() {
+			cloneCommand.ExecuteCloneCommand(
+				ctx, config, backend, cloneCommandViewModel.ErrorViewModel.ErrorChannel, cloneCommandViewModel,
+			)
+		})
+		reportFlags.write(cloneCommandViewModel.ClonedNowViewModel.RunReport)
+	case "plan":
+		planFlags := flag.NewFlagSet("plan", flag.ExitOnError)
+		outputPath := planFlags.String("o", "", "Write the plan to this file instead of standard output")
+		addFailFastFlag(planFlags, failFast)
+		_ = planFlags.Parse(flag.Args()[1:])
+		cloneCommandViewModel := terminalView.NewCloneCommandViewModel()
+		watchErrors(cloneCommandViewModel.ErrorViewModel)
+		var clonePlan []gitrepo.ClonePlanEntry
+		makePlan := func() {
+			clonePlan = cloneCommand.ExecuteClonePlanCommand(
+				ctx, config, backend, cloneCommandViewModel.ErrorViewModel.ErrorChannel, cloneCommandViewModel,
+			)
+		}
+		if *outputPath == "" {
+			// Progress would end up in the plan, errors are still logged
+			makePlan()
+		} else {
+			renderWhile(terminalView.NewClonePlanView(cloneCommandViewModel), makePlan)
+		}
+		err := writeOutput(*outputPath, func(out io.Writer) error {
+			return cloneCommand.WritePlan(out, cloneCommand.NewPlan(clonePlan))
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write plan: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		if *outputPath != "" {
+			cloneCommand.PrintClonePlan(os.Stdout, clonePlan)
+			fmt.Printf("Plan written to %s, run gcm apply %s to clone\n", *outputPath, *outputPath)
+		}
+	case "apply":
+		applyFlags := flag.NewFlagSet("apply", flag.ExitOnError)
+		reportFlags := addRunReportFlags(applyFlags)
+		addFailFastFlag(applyFlags, failFast)
+		_ = applyFlags.Parse(flag.Args()[1:])
+		planPath := applyFlags.Arg(0)
+		if planPath == "" {
+			fmt.Fprintf(os.Stderr, "Usage: gcm apply [-report-json <file>] [-report-junit <file>] <plan file>\n")
+			os.Exit(exitConfigError)
+		}
+		plan, err := cloneCommand.ReadPlan(planPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read plan: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		cloneCommandViewModel := terminalView.NewCloneCommandViewModel()
+		watchErrors(cloneCommandViewModel.ErrorViewModel)
+		renderWhile(terminalView.NewCloneCommandView(cloneCommandViewModel), func() {
+			cloneCommand.ExecuteApplyCommand(
+				ctx, plan, config, backend, cloneCommandViewModel.ErrorViewModel.ErrorChannel, cloneCommandViewModel,
+			)
+		})
+		reportFlags.write(cloneCommandViewModel.ClonedNowViewModel.RunReport)
+	case "unshallow":
+		unshallowFlags := flag.NewFlagSet("unshallow", flag.ExitOnError)
+		addFailFastFlag(unshallowFlags, failFast)
+		_ = unshallowFlags.Parse(flag.Args()[1:])
+		unshallowViewModel := unshallowCommand.NewUnshallowCommandViewModel()
+		watchErrors(unshallowViewModel.ErrorViewModel)
+		errorChannel := unshallowViewModel.ErrorViewModel.ErrorChannel
+		renderWhile(unshallowCommand.NewUnshallowCommandView(unshallowViewModel), func() {
+			unshallowCommand.ExecuteUnshallowCommand(
+				ctx, workspace.ClonedRepositories(ctx, config, backend, errorChannel), errorChannel, unshallowViewModel,
+			)
+		})
+	case "lfs":
+		if flag.Arg(1) != "pull" {
+			fmt.Fprintf(os.Stderr, "Unknown lfs command %q. Commands: lfs pull\n", flag.Arg(1))
+			os.Exit(exitConfigError)
+		}
+		lfsFlags := flag.NewFlagSet("lfs pull", flag.ExitOnError)
+		addFailFastFlag(lfsFlags, failFast)
+		_ = lfsFlags.Parse(flag.Args()[2:])
+		lfsViewModel := lfsCommand.NewLfsPullCommandViewModel()
+		watchErrors(lfsViewModel.ErrorViewModel)
+		errorChannel := lfsViewModel.ErrorViewModel.ErrorChannel
+		renderWhile(lfsCommand.NewLfsPullCommandView(lfsViewModel), func() {
+			lfsCommand.ExecuteLfsPullCommand(
+				ctx, workspace.ClonedRepositories(ctx, config, backend, errorChannel), errorChannel, lfsViewModel,
+			)
+		})
+	case "repair":
+		repairFlags := flag.NewFlagSet("repair", flag.ExitOnError)
+		yes := repairFlags.Bool("yes", false, "Repair without asking")
+		addFailFastFlag(repairFlags, failFast)
+		_ = repairFlags.Parse(flag.Args()[1:])
+		repairViewModel := repairCommand.NewRepairCommandViewModel()
+		watchErrors(repairViewModel.ErrorViewModel)
+		errorChannel := repairViewModel.ErrorViewModel.ErrorChannel
+		repairView := repairCommand.NewRepairCommandView(repairViewModel)
+		var diagnoses []repairCommand.Diagnosis
+		renderWhile(repairView, func() {
+			diagnoses = repairCommand.ExecuteDiagnoseCommand(
+				ctx, workspace.Repositories(ctx, config, backend, errorChannel), errorChannel, repairViewModel,
+			)
+		})
+		if len(diagnoses) == 0 {
+			break
+		}
+		repairCommand.PrintDiagnoses(os.Stdout, diagnoses)
+		if !*yes && !term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Println("Run gcm repair -yes to repair")
+			break
+		}
+		if *yes || repairCommand.ConfirmRepair(os.Stdin, os.Stdout, diagnoses) {
+			renderWhile(repairView, func() {
+				repairCommand.ExecuteRepairCommand(ctx, diagnoses, errorChannel, repairViewModel)
+			})
+		}
+	case "remotes":
+		remotesFlags := flag.NewFlagSet("remotes", flag.ExitOnError)
+		apply := remotesFlags.Bool("apply", false, "Rewrite outdated origin URLs instead of only listing them")
+		addFailFastFlag(remotesFlags, failFast)
+		_ = remotesFlags.Parse(flag.Args()[1:])
+		remotesViewModel := remotesCommand.NewRemotesCommandViewModel()
+		watchErrors(remotesViewModel.ErrorViewModel)
+		errorChannel := remotesViewModel.ErrorViewModel.ErrorChannel
+		remotesView := remotesCommand.NewRemotesCommandView(remotesViewModel)
+		var drifts []remotesCommand.Drift
+		renderWhile(remotesView, func() {
+			drifts = remotesCommand.ExecuteFindDriftCommand(
+				ctx, workspace.ClonedRepositories(ctx, config, backend, errorChannel), errorChannel, remotesViewModel,
+			)
+		})
+		remotesCommand.PrintDrifts(os.Stdout, drifts)
+		if len(drifts) > 0 && !*apply {
+			fmt.Println("Dry run, run gcm remotes -apply to rewrite these origin URLs")
+		}
+		if len(drifts) > 0 && *apply {
+			renderWhile(remotesView, func() {
+				remotesCommand.ExecuteFixDriftCommand(ctx, drifts, errorChannel, remotesViewModel)
+			})
+		}
+	case "bundle":
+		bundleFlags := flag.NewFlagSet("bundle", flag.ExitOnError)
+		addFailFastFlag(bundleFlags, failFast)
+		if flag.NArg() > 1 {
+			_ = bundleFlags.Parse(flag.Args()[2:])
+		}
+		bundleDirectory := bundleFlags.Arg(0)
+		if (flag.Arg(1) != "create" && flag.Arg(1) != "restore") || bundleDirectory == "" {
+			fmt.Fprintf(os.Stderr, "Usage: gcm bundle create <directory>, gcm bundle restore <directory>\n")
+			os.Exit(exitConfigError)
+		}
+		bundleViewModel := bundleCommand.NewBundleCommandViewModel()
+		watchErrors(bundleViewModel.ErrorViewModel)
+		errorChannel := bundleViewModel.ErrorViewModel.ErrorChannel
+		if flag.Arg(1) == "create" {
+			renderWhile(bundleCommand.NewBundleCreateCommandView(bundleViewModel), func() {
+				bundleCommand.ExecuteBundleCreateCommand(
+					ctx,
+					bundleDirectory,
+					workspace.ClonedRepositories(ctx, config, backend, errorChannel),
+					errorChannel,
+					bundleViewModel,
+				)
+			})
+			break
+		}
+		renderWhile(bundleCommand.NewBundleRestoreCommandView(bundleViewModel), func() {
+			bundleCommand.ExecuteBundleRestoreCommand(
+				ctx, bundleDirectory, config, backend, errorChannel, bundleViewModel,
+			)
+		})
+	case "fetch":
+		fetchFlags := flag.NewFlagSet("fetch", flag.ExitOnError)
+		all := fetchFlags.Bool("all", false, "Fetch all remotes, not only origin")
+		tags := fetchFlags.Bool("tags", false, "Fetch all tags")
+		workers := fetchFlags.Int("workers", fetchCommand.DefaultWorkers, "Working copies fetched at the same time")
+		addFailFastFlag(fetchFlags, failFast)
+		_ = fetchFlags.Parse(flag.Args()[1:])
+		fetchViewModel := fetchCommand.NewFetchCommandViewModel()
+		watchErrors(fetchViewModel.ErrorViewModel)
+		renderWhile(fetchCommand.NewFetchCommandView(fetchViewModel), func() {
+			fetchCommand.ExecuteFetchCommand(
+				ctx,
+				config,
+				backend,
+				gitrepo.FetchOptions{Prune: true, All: *all, Tags: *tags},
+				*workers,
+				fetchViewModel.ErrorViewModel.ErrorChannel,
+				fetchViewModel,
+			)
+		})
+	case "usage":
+		usageFlags := flag.NewFlagSet("usage", flag.ExitOnError)
+		sortKey := usageFlags.String("sort", "total", "Sort by "+strings.Join(usageCommand.SortKeys, ", "))
+		format := usageFlags.String("format", "table", "Report format, one of "+strings.Join(usageCommand.Formats, ", "))
+		outputPath := usageFlags.String("o", "", "Write the report to this file instead of standard output")
+		addFailFastFlag(usageFlags, failFast)
+		_ = usageFlags.Parse(flag.Args()[1:])
+		if !slices.Contains(usageCommand.SortKeys, *sortKey) || !slices.Contains(usageCommand.Formats, *format) {
+			usageFlags.Usage()
+			os.Exit(exitConfigError)
+		}
+		usageViewModel := usageCommand.NewUsageCommandViewModel()
+		watchErrors(usageViewModel.ErrorViewModel)
+		errorChannel := usageViewModel.ErrorViewModel.ErrorChannel
+		var report *usageCommand.Report
+		measure := func() {
+			report = usageCommand.ExecuteUsageCommand(
+				ctx, workspace.ClonedRepositories(ctx, config, backend, errorChannel), errorChannel, usageViewModel,
+			)
+		}
+		if *outputPath == "" && *format != "table" {
+			// Progress would end up in the exported report, errors are still logged
+			measure()
+		} else {
+			renderWhile(usageCommand.NewUsageCommandView(usageViewModel), measure)
+		}
+		err := writeOutput(*outputPath, func(out io.Writer) error {
+			return usageCommand.WriteReport(out, report, *sortKey, *format)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+			os.Exit(exitFailure)
+		}
+	default:
+		fmt.Fprintf(
+			os.Stderr,
+			"Unknown command %q. Commands: clone (default), plan, apply, fetch, unshallow, lfs pull, repair, remotes, "+
+				"bundle, usage\n",
+			command,
+		)
+		os.Exit(exitConfigError)
 	}
-	isTTY := term.IsTerminal(int(os.Stdout.Fd()))
 
-	cloneCommandViewModel := terminalView.NewCloneCommandViewModel()
+	if interruptCtx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		os.Exit(exitInterrupted)
+	}
+	if errorViewModel != nil {
+		os.Exit(exitCode(errorViewModel.Errors()))
+	}
+}
+
+// exitCode tells how a command went from its errors
+func exitCode(errs []error) int {
+	if len(errs) == 0 {
+		return exitSuccess
+	}
+	for _, err := range errs {
+		if errors.Is(err, gitlab.ErrNotAuthenticated) {
+			return exitAuthError
+		}
+	}
+	return exitFailure
+}
+
+const failFastUsage = "Stop at the first error instead of continuing with other repositories"
+
+// addFailFastFlag accepts -fail-fast after the command too, e.g. gcm clone -fail-fast
+func addFailFastFlag(flags *flag.FlagSet, failFast *bool) {
+	flags.BoolVar(failFast, "fail-fast", *failFast, failFastUsage)
+}
+
+// runReportFlags Files to write the report of a clone run to
+type runReportFlags struct {
+	jsonPath  *string
+	junitPath *string
+}
+
+func addRunReportFlags(flags *flag.FlagSet) runReportFlags {
+	return runReportFlags{
+		jsonPath:  flags.String("report-json", "", "Write the outcome of every repository as JSON to this file"),
+		junitPath: flags.String("report-junit", "", "Write the outcome of every repository as JUnit XML to this file"),
+	}
+}
+
+func (reportFlags runReportFlags) write(report *gitrepo.RunReport) {
+	writeReport := func(reportPath string, write func(io.Writer, *gitrepo.RunReport) error) {
+		if reportPath == "" {
+			return
+		}
+		out, err := os.Create(reportPath)
+		if err == nil {
+			err = write(out, report)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write report %s: %v\n", reportPath, err)
+		}
+	}
+	writeReport(*reportFlags.jsonPath, cloneCommand.WriteJSONReport)
+	writeReport(*reportFlags.junitPath, cloneCommand.WriteJUnitReport)
+}
 
-	cloneView := terminalView.NewCloneCommandView(cloneCommandViewModel)
+// writeOutput calls write with the file at outputPath, or standard output when outputPath is empty. The file is
+// closed before returning, failing to close it fails the write, as buffered content may be lost.
+func writeOutput(outputPath string, write func(io.Writer) error) error {
+	if outputPath == "" {
+		return write(os.Stdout)
+	}
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	err = write(out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// interruptContexts returns a context that is done on the first interrupt or SIGTERM, after which no new work starts,
+// and a context that is done shutdownGracePeriod later, or on a second interrupt, to kill running git processes.
+// git runs in process groups of its own, so gcm has to stay alive to kill it and remove what it left behind. Only a
+// third interrupt terminates gcm immediately.
+func interruptContexts() (ctx context.Context, killCtx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	ctx, interrupt := context.WithCancel(context.Background())
+	killCtx, kill := context.WithCancel(context.Background())
+	go func() {
+		<-signals
+		interrupt()
+		Log.Warnf("Interrupted, waiting up to %v for running git commands, interrupt again to kill them", shutdownGracePeriod)
+		gracePeriod := time.NewTimer(shutdownGracePeriod)
+		select {
+		case <-signals:
+			Log.Warnf("Interrupted again, killing running git commands")
+		case <-gracePeriod.C:
+		}
+		kill()
+		signal.Stop(signals)
+	}()
+	return ctx, killCtx
+}
+
+// renderWhile keeps rendering commandView on a terminal while run executes, otherwise renders once when done
+func renderWhile(commandView view.View, run func()) {
+	isTTY := term.IsTerminal(int(os.Stdout.Fd()))
 
 	ctx, stopRenderLoop := context.WithCancel(context.Background())
+	renderLoopDone := make(chan struct{})
 	if isTTY {
-		go view.StartTTYRenderLoop(cloneView, os.Stdout, ctx, os.Stdout)
+		go func() {
+			defer close(renderLoopDone)
+			view.StartTTYRenderLoop(commandView, os.Stdout, ctx, os.Stdout)
+		}()
+	} else {
+		close(renderLoopDone)
 	}
 
-	cloneCommand.ExecuteCloneCommand(config, cloneCommandViewModel.ErrorViewModel.ErrorChannel, cloneCommandViewModel)
+	run()
 
 	stopRenderLoop()
+	<-renderLoopDone
 
 	if !isTTY {
-		cloneView.Render(0)
+		commandView.Render(0)
 	}
-
 }
 
 func loadConfig(configFileName string) (*appConfig.AppConfig, error) {